@@ -45,7 +45,9 @@ type Accumulator interface {
 		tags map[string]string,
 		t ...time.Time)
 
-	//SetPrecision(precision, interval time.Duration)
+	// SetPrecision rounds the timestamps of the metrics to precision, or to
+	// the order of interval, at most a second, when precision is zero.
+	SetPrecision(precision, interval time.Duration)
 
 	AddError(err error)
 }
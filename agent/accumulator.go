@@ -9,6 +9,8 @@ type accumulator struct {
 	metrics   chan asgard.Metric
 	maker     MetricMaker
 	precision time.Duration
+	// done drops the metrics added once it is closed
+	done <-chan struct{}
 }
 
 // MetricMaker ...
@@ -19,6 +21,9 @@ type MetricMaker interface {
 		tags map[string]string,
 		mType asgard.ValueType,
 		t time.Time) asgard.Metric
+
+	// LogError counts and logs a runtime error of the plugin
+	LogError(err error)
 }
 
 // NewAccumulator ...
@@ -41,7 +46,7 @@ func (ac *accumulator) AddFields(
 	t ...time.Time) {
 
 	if m := ac.maker.MakeMetric(measurement, fields, tags, asgard.Untyped, ac.getTime(t)); m != nil {
-		ac.metrics <- m
+		ac.addMetric(m)
 	}
 }
 
@@ -52,7 +57,7 @@ func (ac *accumulator) AddGauge(
 	t ...time.Time) {
 
 	if m := ac.maker.MakeMetric(measurement, fields, tags, asgard.Gauge, ac.getTime(t)); m != nil {
-		ac.metrics <- m
+		ac.addMetric(m)
 	}
 }
 
@@ -63,7 +68,7 @@ func (ac *accumulator) AddCounter(
 	t ...time.Time) {
 
 	if m := ac.maker.MakeMetric(measurement, fields, tags, asgard.Counter, ac.getTime(t)); m != nil {
-		ac.metrics <- m
+		ac.addMetric(m)
 	}
 }
 
@@ -74,7 +79,7 @@ func (ac *accumulator) AddSummary(
 	t ...time.Time) {
 
 	if m := ac.maker.MakeMetric(measurement, fields, tags, asgard.Summary, ac.getTime(t)); m != nil {
-		ac.metrics <- m
+		ac.addMetric(m)
 	}
 }
 
@@ -85,16 +90,58 @@ func (ac *accumulator) AddHistogram(
 	t ...time.Time) {
 
 	if m := ac.maker.MakeMetric(measurement, fields, tags, asgard.Histogram, ac.getTime(t)); m != nil {
-		ac.metrics <- m
+		ac.addMetric(m)
 	}
 }
 
+// addMetric sends m to the metrics channel. It only gives up when the
+// channel is full and done is closed.
+func (ac *accumulator) addMetric(m asgard.Metric) {
+	select {
+	case ac.metrics <- m:
+		return
+	default:
+	}
+	select {
+	case ac.metrics <- m:
+	case <-ac.done:
+	}
+}
+
+// SetDone sets the channel closed when nobody reads the metrics anymore, the
+// metrics added once it is closed are dropped. A gather abandoned on shutdown
+// doesn't block then.
+func (ac *accumulator) SetDone(done <-chan struct{}) {
+	ac.done = done
+}
+
 // AddError passes a runtime error to the accumulator.
 // The error will be tagged with the plugin name and written to the log.
 func (ac *accumulator) AddError(err error) {
 	if err == nil {
 		return
 	}
+	ac.maker.LogError(err)
+}
+
+// SetPrecision sets the precision timestamps are rounded to. When precision
+// is zero it is derived from interval: an interval of at least a second is
+// rounded to seconds, one of at least a millisecond to milliseconds, etc.
+func (ac *accumulator) SetPrecision(precision, interval time.Duration) {
+	if precision > 0 {
+		ac.precision = precision
+		return
+	}
+	switch {
+	case interval >= time.Second:
+		ac.precision = time.Second
+	case interval >= time.Millisecond:
+		ac.precision = time.Millisecond
+	case interval >= time.Microsecond:
+		ac.precision = time.Microsecond
+	default:
+		ac.precision = time.Nanosecond
+	}
 }
 
 func (ac accumulator) getTime(t []time.Time) time.Time {
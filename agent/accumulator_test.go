@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/models"
+)
+
+func TestAccumulatorDone(t *testing.T) {
+	input := models.NewRunningInput(&gatherInput{}, &models.InputConfig{Name: "accumulator"})
+	defer input.UnregisterStats()
+
+	tests := []struct {
+		name string
+		// buffered is the size of the metrics channel
+		buffered int
+		done     bool
+		// sent tells whether the metric is expected on the channel
+		sent bool
+	}{
+		{name: "buffered", buffered: 1, sent: true},
+		{name: "buffered and done", buffered: 1, done: true, sent: true},
+		{name: "full and done", done: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricC := make(chan asgard.Metric, tt.buffered)
+			done := make(chan struct{})
+			if tt.done {
+				close(done)
+			}
+			acc := NewAccumulator(input, metricC)
+			acc.SetDone(done)
+
+			added := make(chan struct{})
+			go func() {
+				acc.AddFields("m", map[string]interface{}{"v": 1}, nil)
+				close(added)
+			}()
+			select {
+			case <-added:
+			case <-time.After(time.Second):
+				t.Fatal("AddFields blocked")
+			}
+			if sent := len(metricC) == 1; sent != tt.sent {
+				t.Errorf("expected sent %v, got %v", tt.sent, sent)
+			}
+		})
+	}
+}
+
+func TestAccumulatorPrecision(t *testing.T) {
+	input := models.NewRunningInput(&gatherInput{}, &models.InputConfig{Name: "precision"})
+	defer input.UnregisterStats()
+	ts := time.Unix(1500000000, 123456789)
+
+	tests := []struct {
+		name      string
+		precision time.Duration
+		interval  time.Duration
+		expected  time.Time
+	}{
+		{name: "precision", precision: time.Millisecond, interval: 10 * time.Second, expected: time.Unix(1500000000, 123000000)},
+		{name: "seconds interval", interval: 10 * time.Second, expected: time.Unix(1500000000, 0)},
+		{name: "milliseconds interval", interval: 250 * time.Millisecond, expected: time.Unix(1500000000, 123000000)},
+		{name: "microseconds interval", interval: 500 * time.Microsecond, expected: time.Unix(1500000000, 123457000)},
+		{name: "nanoseconds interval", interval: 100, expected: ts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricC := make(chan asgard.Metric, 1)
+			acc := NewAccumulator(input, metricC)
+			acc.SetPrecision(tt.precision, tt.interval)
+			acc.AddFields("m", map[string]interface{}{"v": 1}, nil, ts)
+			if m := <-metricC; !m.Time().Equal(tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, m.Time())
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/anabiozz/asgard/internal/models"
+)
+
+// Plugins lists the plugin instances of the agent, served on /plugins
+type Plugins struct {
+	Inputs      []PluginInfo `json:"inputs"`
+	Outputs     []PluginInfo `json:"outputs"`
+	Processors  []PluginInfo `json:"processors"`
+	Aggregators []PluginInfo `json:"aggregators"`
+}
+
+// PluginInfo describes a plugin instance
+type PluginInfo struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+}
+
+// Plugins returns the plugin instances of the agent
+func (a *Agent) Plugins() Plugins {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	p := Plugins{
+		Inputs:      make([]PluginInfo, 0, len(a.Config.Inputs)),
+		Outputs:     make([]PluginInfo, 0, len(a.Config.Outputs)),
+		Processors:  make([]PluginInfo, 0, len(a.Config.Processors)),
+		Aggregators: make([]PluginInfo, 0, len(a.Config.Aggregators)),
+	}
+	for _, input := range a.Config.Inputs {
+		p.Inputs = append(p.Inputs, PluginInfo{
+			Name:     input.Name(),
+			Interval: a.inputSettings(input).interval.String(),
+		})
+	}
+	for _, o := range a.Config.Outputs {
+		p.Outputs = append(p.Outputs, PluginInfo{
+			Name:   "outputs." + o.Name,
+			Paused: o.Paused(),
+		})
+	}
+	for _, rp := range a.Config.Processors {
+		p.Processors = append(p.Processors, PluginInfo{Name: rp.Name()})
+	}
+	for _, ra := range a.Config.Aggregators {
+		p.Aggregators = append(p.Aggregators, PluginInfo{
+			Name:     ra.Name(),
+			Interval: ra.Config.Period.String(),
+		})
+	}
+	return p
+}
+
+// GatherInput gathers the named input right away. The name is the one of
+// the instance, ie "inputs.influxdb::cluster-a", the "inputs." prefix may be
+// left out. Every instance of the name is gathered.
+func (a *Agent) GatherInput(name string) error {
+	name = strings.TrimPrefix(name, "inputs.")
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.running {
+		return fmt.Errorf("agent is not running")
+	}
+	found := false
+	for _, g := range a.gatherers {
+		if strings.TrimPrefix(g.input.Name(), "inputs.") != name {
+			continue
+		}
+		found = true
+		select {
+		case g.trigger <- struct{}{}:
+		default:
+			// a gather is already pending
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown input %q", name)
+	}
+	return nil
+}
+
+// findOutputs returns the outputs of the given name, the "outputs." prefix
+// may be left out
+func (a *Agent) findOutputs(name string) ([]*models.RunningOutput, error) {
+	name = strings.TrimPrefix(name, "outputs.")
+
+	var found []*models.RunningOutput
+	for _, o := range a.outputs() {
+		if o.Name == name {
+			found = append(found, o)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("unknown output %q", name)
+	}
+	return found, nil
+}
+
+// FlushOutput writes the buffered metrics of the named output right away
+func (a *Agent) FlushOutput(name string) error {
+	outputs, err := a.findOutputs(name)
+	if err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		if o.Paused() {
+			return fmt.Errorf("output %q is paused", name)
+		}
+	}
+	for _, o := range outputs {
+		if err := o.Write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PauseOutput stops writing to the named output, metrics are buffered
+// meanwhile up to metric_buffer_limit. Writing resumes with ResumeOutput.
+func (a *Agent) PauseOutput(name string) error {
+	outputs, err := a.findOutputs(name)
+	if err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		o.Pause()
+	}
+	return nil
+}
+
+// ResumeOutput writes to the named output again after PauseOutput, the
+// buffered metrics are written at the next flush
+func (a *Agent) ResumeOutput(name string) error {
+	outputs, err := a.findOutputs(name)
+	if err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		o.Resume()
+	}
+	return nil
+}
+
+// adminHandler serves the admin API:
+//
+//	GET  /plugins                   lists the plugin instances
+//	POST /inputs/<name>/gather      gathers an input right away
+//	POST /outputs/<name>/flush      writes the buffered metrics of an output
+//	POST /outputs/<name>/pause      stops writing to an output
+//	POST /outputs/<name>/resume     writes to a paused output again
+//	POST /reload                    reloads the config
+//
+// Requests with an Origin header are rejected, browsers send it so a web
+// page can't reach the API on a loopback address.
+func (a *Agent) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plugins", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, a.Plugins())
+	})
+	mux.HandleFunc("/inputs/", func(w http.ResponseWriter, r *http.Request) {
+		name, action := splitAction(r.URL.Path, "/inputs/")
+		if action != "gather" {
+			http.NotFound(w, r)
+			return
+		}
+		adminAction(w, r, func() error { return a.GatherInput(name) })
+	})
+	mux.HandleFunc("/outputs/", func(w http.ResponseWriter, r *http.Request) {
+		name, action := splitAction(r.URL.Path, "/outputs/")
+		var f func(string) error
+		switch action {
+		case "flush":
+			f = a.FlushOutput
+		case "pause":
+			f = a.PauseOutput
+		case "resume":
+			f = a.ResumeOutput
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		adminAction(w, r, func() error { return f(name) })
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		adminAction(w, r, func() error {
+			if a.ReloadConfig == nil {
+				return fmt.Errorf("reloading is not supported")
+			}
+			return a.ReloadConfig()
+		})
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "cross-origin requests are not allowed"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// splitAction splits "/outputs/influxdb/flush" into "influxdb" and "flush"
+func splitAction(path, prefix string) (string, string) {
+	path = strings.TrimPrefix(path, prefix)
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// adminAction runs f for a POST request and writes its result
+func adminAction(w http.ResponseWriter, r *http.Request, f func() error) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if err := f(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/metric"
+)
+
+func TestAdminHandler(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	output := &testOutput{}
+	ro := models.NewRunningOutput("test", output, &models.OutputConfig{Name: "test", Alias: "admin"}, 10, 10)
+	defer ro.UnregisterStats()
+	c.Outputs = append(c.Outputs, ro)
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := metric.New("m", nil, map[string]interface{}{"v": 1}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro.AddMetric(m)
+
+	reloads := 0
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		origin string
+		// reload is set as the ReloadConfig of the agent
+		reload  func() error
+		code    int
+		body    string
+		written int
+	}{
+		{name: "plugins", method: "GET", path: "/plugins", code: http.StatusOK, body: `"outputs.test::admin"`},
+		{name: "POST plugins", method: "POST", path: "/plugins", code: http.StatusMethodNotAllowed},
+		{name: "cross-origin plugins", method: "GET", path: "/plugins", origin: "http://example.com", code: http.StatusForbidden, body: "cross-origin"},
+		{name: "cross-origin pause", method: "POST", path: "/outputs/test::admin/pause", origin: "http://example.com", code: http.StatusForbidden},
+		{name: "GET action", method: "GET", path: "/outputs/test::admin/pause", code: http.StatusMethodNotAllowed},
+		{name: "pause", method: "POST", path: "/outputs/test::admin/pause", code: http.StatusOK},
+		{name: "paused", method: "GET", path: "/plugins", code: http.StatusOK, body: `"paused": true`},
+		{name: "flush paused", method: "POST", path: "/outputs/test::admin/flush", code: http.StatusBadRequest, body: "is paused"},
+		{name: "resume", method: "POST", path: "/outputs/test::admin/resume", code: http.StatusOK},
+		{name: "flush", method: "POST", path: "/outputs/outputs.test::admin/flush", code: http.StatusOK, written: 1},
+		{name: "unknown output", method: "POST", path: "/outputs/test/flush", code: http.StatusBadRequest, body: `unknown output`, written: 1},
+		{name: "unknown action", method: "POST", path: "/outputs/test::admin/drop", code: http.StatusNotFound, written: 1},
+		{name: "gather stopped agent", method: "POST", path: "/inputs/test/gather", code: http.StatusBadRequest, body: "agent is not running", written: 1},
+		{name: "reload unsupported", method: "POST", path: "/reload", code: http.StatusBadRequest, body: "reloading is not supported", written: 1},
+		{
+			name:    "reload",
+			method:  "POST",
+			path:    "/reload",
+			reload:  func() error { reloads++; return nil },
+			code:    http.StatusOK,
+			written: 1,
+		},
+		{
+			name:    "cross-origin reload",
+			method:  "POST",
+			path:    "/reload",
+			origin:  "null",
+			reload:  func() error { reloads++; return nil },
+			code:    http.StatusForbidden,
+			written: 1,
+		},
+		{
+			name:    "failed reload",
+			method:  "POST",
+			path:    "/reload",
+			reload:  func() error { return errors.New("broken config") },
+			code:    http.StatusBadRequest,
+			body:    "broken config",
+			written: 1,
+		},
+	}
+
+	handler := a.adminHandler()
+	for _, step := range steps {
+		a.ReloadConfig = step.reload
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(step.method, step.path, nil)
+		if step.origin != "" {
+			req.Header.Set("Origin", step.origin)
+		}
+		handler.ServeHTTP(w, req)
+		if w.Code != step.code {
+			t.Errorf("%s: expected status %d, got %d: %s", step.name, step.code, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), step.body) {
+			t.Errorf("%s: expected %q in %s", step.name, step.body, w.Body)
+		}
+		if len(output.written) != step.written {
+			t.Errorf("%s: expected %d metrics written, got %d", step.name, step.written, len(output.written))
+		}
+	}
+	if reloads != 1 {
+		t.Errorf("expected 1 reload, got %d", reloads)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name         string
+		addr         string
+		loopbackOnly bool
+		err          string
+	}{
+		{name: "loopback", addr: "127.0.0.1:0", loopbackOnly: true},
+		{name: "localhost", addr: "localhost:0", loopbackOnly: true},
+		{name: "not loopback", addr: "0.0.0.0:0", loopbackOnly: true, err: "is not a loopback address"},
+		{name: "any address", addr: "0.0.0.0:0"},
+		{name: "unix socket", addr: "unix://" + filepath.Join(dir, "admin.sock"), loopbackOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := listenAddr(tt.addr, tt.loopbackOnly)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer l.Close()
+			if strings.HasPrefix(tt.addr, "unix://") {
+				path := strings.TrimPrefix(tt.addr, "unix://")
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if perm := info.Mode().Perm(); perm != 0600 {
+					t.Errorf("expected mode 0600, got %o", perm)
+				}
+				files, err := ioutil.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(files) != 1 {
+					t.Errorf("expected only the socket in %s, got %d files", dir, len(files))
+				}
+				l.Close()
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("expected the socket to be removed on close, got %v", err)
+				}
+			}
+		})
+	}
+}
@@ -1,60 +1,192 @@
 package agent
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal"
 	"github.com/anabiozz/asgard/internal/config"
 	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/internal/secrets"
 )
 
 // Agent ...
 type Agent struct {
 	Config *config.Config
+
+	// ReloadConfig loads and applies the config again when a reload is
+	// requested over the admin API
+	ReloadConfig func() error
+
+	// mu guards Config, gatherers, aggregatorRunners and running, which
+	// change when the agent is reloaded
+	mu                sync.RWMutex
+	gatherers         []*inputGatherer
+	aggregatorRunners []*aggregatorRunner
+	running           bool
+
+	// channel shared between all input threads for accumulating metrics
+	metricC chan asgard.Metric
+
+	// aggMetricC takes the metrics pushed by the aggregators to the outputs
+	aggMetricC chan asgard.Metric
+
+	// reloadC tells the flusher to pick up a new flush interval
+	reloadC chan struct{}
+
+	// health serves /health and /status and admin the admin API while the
+	// agent runs, guarded by mu
+	health *server
+	admin  *server
+}
+
+// inputGatherer is the gatherer goroutine of a running input
+type inputGatherer struct {
+	input *models.RunningInput
+	stop  chan struct{}
+	done  chan struct{}
+	// trigger gathers the input right away
+	trigger chan struct{}
+	// service is set when the input is an asgard.ServiceInput that was
+	// started, it is stopped after the gatherer
+	service bool
 }
 
 // NewAgent returns an Agent struct based off the given Config
 func NewAgent(config *config.Config) (*Agent, error) {
+	if err := prepareConfig(config); err != nil {
+		return nil, err
+	}
+	secrets.SetStores(config.SecretStores)
 
 	a := &Agent{
-		Config: config,
+		Config:     config,
+		metricC:    make(chan asgard.Metric, 100),
+		aggMetricC: make(chan asgard.Metric, 100),
+		reloadC:    make(chan struct{}, 1),
 	}
-	if !a.Config.Agent.OmitHostname {
-		if a.Config.Agent.Hostname == "" {
+	a.health = &server{name: "/health and /status", handler: a.healthHandler()}
+	a.admin = &server{name: "admin API", handler: a.adminHandler(), loopbackOnly: true}
+	return a, nil
+}
+
+// prepareConfig sets the host tag and hands the daemon-wide tags to every
+// input of the config.
+func prepareConfig(config *config.Config) error {
+	if !config.Agent.OmitHostname {
+		if config.Agent.Hostname == "" {
 			hostname, err := os.Hostname()
 			if err != nil {
-				return nil, err
+				return err
 			}
-			a.Config.Agent.Hostname = hostname
+			config.Agent.Hostname = hostname
 		}
 
-		config.Tags["host"] = a.Config.Agent.Hostname
+		config.Tags["host"] = config.Agent.Hostname
 	}
 
-	return a, nil
+	for _, input := range config.Inputs {
+		input.SetDefaultTags(config.Tags)
+	}
+	return nil
+}
+
+// outputs returns the outputs the agent currently writes to
+func (a *Agent) outputs() []*models.RunningOutput {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Config.Outputs
+}
+
+// inputs returns the inputs of the agent and the settings each of them is
+// gathered with
+func (a *Agent) inputs() ([]*models.RunningInput, []gatherSettings) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	settings := make([]gatherSettings, len(a.Config.Inputs))
+	for i, input := range a.Config.Inputs {
+		settings[i] = a.inputSettings(input)
+	}
+	return a.Config.Inputs, settings
+}
+
+// processors returns the processors the agent currently applies
+func (a *Agent) processors() []*models.RunningProcessor {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Config.Processors
+}
+
+// process applies the processors to a metric in order
+func process(processors []*models.RunningProcessor, m asgard.Metric) []asgard.Metric {
+	metrics := []asgard.Metric{m}
+	for _, p := range processors {
+		metrics = p.Apply(metrics...)
+	}
+	return metrics
+}
+
+// addMetric adds the metric to every output, the outputs but the last one
+// get a copy
+func addMetric(outputs []*models.RunningOutput, m asgard.Metric) {
+	for i, o := range outputs {
+		if i == len(outputs)-1 {
+			o.AddMetric(m)
+		} else {
+			o.AddMetric(m.Copy())
+		}
+	}
+}
+
+// flushInterval returns the current flush interval and jitter of the agent
+func (a *Agent) flushInterval() (interval, jitter time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Config.Agent.FlushInterval.Duration, a.Config.Agent.FlushJitter.Duration
+}
+
+// InputErrors returns the errors counted for every running input instance,
+// keyed by the name of the instance
+func (a *Agent) InputErrors() map[string]models.ErrorCount {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	errors := make(map[string]models.ErrorCount, len(a.Config.Inputs))
+	for _, input := range a.Config.Inputs {
+		errors[input.Name()] = input.Errors()
+	}
+	return errors
 }
 
 // gatherWithTimeout gathers from the given input, with the given timeout.
-//   when the given timeout is reached, gatherWithTimeout logs an error message
-//   but continues waiting for it to return. This is to avoid leaving behind
-//   hung processes, and to prevent re-calling the same hung process over and
-//   over.
+// When the given timeout is reached, the context of an asgard.ContextInput
+// is cancelled. gatherWithTimeout logs an error message and continues
+// waiting for the input to return. This is to avoid leaving behind hung
+// processes, and to prevent re-calling the same hung process over and
+// over. On shutdown the context is cancelled and gatherWithTimeout returns
+// right away, the metrics the input still adds are dropped once the
+// accumulator is done.
 func gatherWithTimeout(
 	shutdown chan struct{},
 	input *models.RunningInput,
 	acc *accumulator,
 	timeout time.Duration) {
 
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	ticker := time.NewTicker(timeout)
 	defer ticker.Stop()
-	done := make(chan error)
+	done := make(chan error, 1)
 
 	go func() {
-		done <- input.Input.Gather(acc)
+		done <- input.Gather(ctx, acc)
 	}()
 
 	for {
@@ -65,7 +197,7 @@ func gatherWithTimeout(
 			}
 			return
 		case <-ticker.C:
-			err := fmt.Errorf("took longer to collect than collection interval (%s)", timeout)
+			err := fmt.Errorf("took longer to collect than timeout (%s)", timeout)
 			acc.AddError(err)
 			continue
 		case <-shutdown:
@@ -89,49 +221,58 @@ func (a *Agent) flusher(
 		defer wg.Done()
 		for {
 			select {
-			case <-shutdown:
-				if len(outMetricC) > 0 {
-					// hold on while outMetricC full
-					continue
+			case m, ok := <-outMetricC:
+				if !ok {
+					// outMetricC is closed on shutdown, the aggregators
+					// pushed their last period by then
+					a.drainAggregated()
+					return
 				}
-				return
-			case m := <-outMetricC:
-				for i, o := range a.Config.Outputs {
-					if i == len(a.Config.Outputs)-1 {
-						o.AddMetric(m)
-					} else {
-						o.AddMetric(m.Copy())
-					}
+				// metrics taken by an aggregator with drop_original
+				// aren't written
+				if aggregate(a.aggregators(), m) {
+					continue
 				}
+				addMetric(a.outputs(), m)
+			case m := <-a.aggMetricC:
+				addMetric(a.outputs(), m)
 			}
 		}
 	}()
 
-	ticker := time.NewTicker(time.Duration(a.Config.Agent.FlushInterval * time.Millisecond))
+	interval, jitter := a.flushInterval()
+	ticker := time.NewTicker(interval)
+	defer func() { ticker.Stop() }()
 	semaphore := make(chan struct{}, 1)
 
 	for {
 		select {
 		case <-shutdown:
-			log.Println("INFO: Hang on, flushing any cached metrics before shutdown")
+			log.Println("I! Hang on, flushing any cached metrics before shutdown")
 			// wait for outMetricC to get flushed before flushing outputs
+			close(outMetricC)
 			wg.Wait()
 			a.flush()
 			return nil
+		case <-a.reloadC:
+			ticker.Stop()
+			interval, jitter = a.flushInterval()
+			ticker = time.NewTicker(interval)
 		case <-ticker.C:
-			go func() {
+			go func(jitter time.Duration) {
+				internal.RandomSleep(jitter, shutdown)
 				select {
 				case semaphore <- struct{}{}:
 					a.flush()
 					<-semaphore
 				default:
 					// skipping this flush because one is already happening
-					log.Println("INFO: Skipping a scheduled flush because there is already a flush ongoing.")
+					log.Println("I! Skipping a scheduled flush because there is already a flush ongoing.")
 				}
-			}()
+			}(jitter)
 		case metric := <-metricC:
 			// NOTE potential bottleneck here as we put each metric through the processors serially.
-			mS := []asgard.Metric{metric}
+			mS := process(a.processors(), metric)
 			for _, m := range mS {
 				outMetricC <- m
 			}
@@ -139,17 +280,33 @@ func (a *Agent) flusher(
 	}
 }
 
+// drainAggregated hands the metrics left in aggMetricC to the outputs
+func (a *Agent) drainAggregated() {
+	for {
+		select {
+		case m := <-a.aggMetricC:
+			addMetric(a.outputs(), m)
+		default:
+			return
+		}
+	}
+}
+
 // flush writes a list of metrics to all configured outputs
 func (a *Agent) flush() {
+	flushOutputs(a.outputs())
+}
 
+// flushOutputs writes the buffered metrics of the given outputs
+func flushOutputs(outputs []*models.RunningOutput) {
 	var wg sync.WaitGroup
-	wg.Add(len(a.Config.Outputs))
-	for _, o := range a.Config.Outputs {
+	wg.Add(len(outputs))
+	for _, o := range outputs {
 		go func(output *models.RunningOutput) {
 			defer wg.Done()
 			err := output.Write()
 			if err != nil {
-				log.Printf("ERROR: Error writing to output [%s]: %s\n", output.Name, err.Error())
+				log.Printf("E! [outputs.%s] Error writing to output: %s", output.Name, err.Error())
 			}
 		}(o)
 	}
@@ -157,31 +314,170 @@ func (a *Agent) flush() {
 }
 
 // gatherer runs the inputs that have been configured with their own reporting interval.
+// A send on trigger gathers the input right away, outside of the interval.
 func (a *Agent) gatherer(
 	shutdown chan struct{},
+	trigger chan struct{},
 	input *models.RunningInput,
-	interval time.Duration,
+	s gatherSettings,
 	metricC chan asgard.Metric) {
 
 	// Create new accumulator
 	acc := NewAccumulator(input, metricC)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	for {
-		gatherWithTimeout(shutdown, input, acc, interval)
+	acc.SetPrecision(s.precision, s.interval)
+	acc.SetDone(shutdown)
+
+	// Start on the next multiple of the interval, ie on :00, :10, :20 for
+	// an interval of 10s
+	if s.roundInterval {
+		i := int64(s.interval)
+		t := time.NewTimer(time.Duration(i - time.Now().UnixNano()%i))
 		select {
+		case <-t.C:
 		case <-shutdown:
+			t.Stop()
 			return
-		case <-ticker.C:
-			continue
+		}
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		internal.RandomSleep(s.jitter, shutdown)
+		gatherWithTimeout(shutdown, input, acc, s.timeout)
+	wait:
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-ticker.C:
+				break wait
+			case <-trigger:
+				gatherWithTimeout(shutdown, input, acc, s.timeout)
+			}
 		}
 	}
 }
 
+// Once gathers every input a single time, writes the processed metrics to the
+// outputs and closes them, aggregators aren't run. It returns an error when an
+// output could not be written.
+func (a *Agent) Once() error {
+	inputs, settings := a.inputs()
+	outputs := a.outputs()
+	processors := a.processors()
+
+	metricC := make(chan asgard.Metric, 100)
+	done := make(chan struct{})
+	go func() {
+		for metric := range metricC {
+			for _, m := range process(processors, metric) {
+				addMetric(outputs, m)
+			}
+		}
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(input *models.RunningInput, s gatherSettings) {
+			defer wg.Done()
+			acc := NewAccumulator(input, metricC)
+			acc.SetPrecision(s.precision, s.interval)
+			ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			defer cancel()
+			if err := input.Gather(ctx, acc); err != nil {
+				acc.AddError(err)
+			}
+		}(input, settings[i])
+	}
+	wg.Wait()
+	close(metricC)
+	<-done
+
+	var failed []string
+	for _, o := range outputs {
+		if err := o.Write(); err != nil {
+			log.Printf("E! [outputs.%s] Error writing to output: %s", o.Name, err.Error())
+			failed = append(failed, o.Name)
+		}
+	}
+	a.Close()
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to write to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// needsPreviousSample lists the inputs that report the difference to the
+// previous gather, their first gather doesn't produce every metric.
+var needsPreviousSample = map[string]bool{
+	"cpu": true,
+}
+
+// Test gathers every input once and prints the processed metrics to stdout
+// sorted by their line protocol, without connecting any output or running
+// the aggregators. Inputs that need a
+// previous sample are gathered twice and only the second gather is printed.
+func (a *Agent) Test() error {
+	inputs, settings := a.inputs()
+	processors := a.processors()
+
+	var lines []string
+	for i, input := range inputs {
+		s := settings[i]
+		if needsPreviousSample[input.Config.Name] {
+			if _, err := testGather(input, s); err != nil {
+				return fmt.Errorf("%s: %s", input.Name(), err)
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		metrics, err := testGather(input, s)
+		if err != nil {
+			return fmt.Errorf("%s: %s", input.Name(), err)
+		}
+		for _, metric := range metrics {
+			for _, m := range process(processors, metric) {
+				lines = append(lines, m.String())
+			}
+		}
+	}
+
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Print(line)
+	}
+	return nil
+}
+
+// testGather gathers the input once and returns the metrics it made
+func testGather(input *models.RunningInput, s gatherSettings) ([]asgard.Metric, error) {
+	metricC := make(chan asgard.Metric)
+	done := make(chan struct{})
+	var metrics []asgard.Metric
+	go func() {
+		for m := range metricC {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+
+	acc := NewAccumulator(input, metricC)
+	acc.SetPrecision(s.precision, s.interval)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	err := input.Gather(ctx, acc)
+	close(metricC)
+	<-done
+	return metrics, err
+}
+
 // Close closes the connection to all configured outputs
 func (a *Agent) Close() error {
 	var err error
-	for _, o := range a.Config.Outputs {
+	for _, o := range a.outputs() {
 		err = o.Output.Close()
 	}
 	return err
@@ -189,50 +485,212 @@ func (a *Agent) Close() error {
 
 // Connect connects to all configured outputs
 func (a *Agent) Connect() error {
-	for _, o := range a.Config.Outputs {
-		log.Printf("DEBUG: Attempting connection to output: %s\n", o.Name)
-		err := o.Output.Connect()
+	for _, o := range a.outputs() {
+		if err := connectOutput(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectOutput connects to the given output, retrying once after 15s
+func connectOutput(o *models.RunningOutput) error {
+	log.Printf("D! [outputs.%s] Attempting connection to output", o.Name)
+	err := o.Output.Connect()
+	if err != nil {
+		log.Printf("E! [outputs.%s] Failed to connect to output, retrying in 15s, error was '%s'", o.Name, err)
+		time.Sleep(15 * time.Second)
+		err = o.Output.Connect()
 		if err != nil {
-			log.Printf("ERROR: Failed to connect to output %s, retrying in 15s, error was '%s' \n", o.Name, err)
-			time.Sleep(15 * time.Second)
-			err = o.Output.Connect()
-			if err != nil {
-				return err
-			}
+			return err
 		}
-		log.Printf("DEBUG: Successfully connected to output: %s\n", o.Name)
 	}
+	log.Printf("D! [outputs.%s] Successfully connected to output", o.Name)
 	return nil
 }
 
+// gatherSettings are the agent settings a gatherer runs with
+type gatherSettings struct {
+	interval      time.Duration
+	timeout       time.Duration
+	roundInterval bool
+	jitter        time.Duration
+	precision     time.Duration
+}
+
+// inputSettings returns the settings the input is gathered with, inputs may
+// override the agent interval and set a timeout, which defaults to the
+// interval. The caller must hold a.mu.
+func (a *Agent) inputSettings(input *models.RunningInput) gatherSettings {
+	s := gatherSettings{
+		interval:      a.Config.Agent.Interval.Duration,
+		roundInterval: a.Config.Agent.RoundInterval,
+		jitter:        a.Config.Agent.CollectionJitter.Duration,
+		precision:     a.Config.Agent.Precision.Duration,
+	}
+	if input.Config.Interval != 0 {
+		s.interval = input.Config.Interval
+	}
+	s.timeout = s.interval
+	if input.Config.Timeout != 0 {
+		s.timeout = input.Config.Timeout
+	}
+	return s
+}
+
+// startInput starts the gatherer of the given input, service tells whether
+// the input is a started service. The caller must hold a.mu.
+func (a *Agent) startInput(input *models.RunningInput, service bool) {
+	settings := a.inputSettings(input)
+
+	g := &inputGatherer{
+		input:   input,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		trigger: make(chan struct{}, 1),
+		service: service,
+	}
+	go func() {
+		defer close(g.done)
+		a.gatherer(g.stop, g.trigger, input, settings, a.metricC)
+	}()
+	a.gatherers = append(a.gatherers, g)
+}
+
+// startServices starts the given inputs that are asgard.ServiceInputs and
+// returns the ones that were started. Services that fail to start are
+// reported in the returned error, the others keep running.
+func (a *Agent) startServices(inputs []*models.RunningInput) (map[*models.RunningInput]bool, error) {
+	started := make(map[*models.RunningInput]bool)
+	var errs []string
+	for _, input := range inputs {
+		service, ok := input.Input.(asgard.ServiceInput)
+		if !ok {
+			continue
+		}
+		// services stamp their own timestamps, they aren't rounded
+		acc := NewAccumulator(input, a.metricC)
+		if err := service.Start(acc); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", input.Name(), err))
+			continue
+		}
+		input.Log().Debugf("Service started")
+		started[input] = true
+	}
+	if len(errs) > 0 {
+		return started, fmt.Errorf("Error starting service inputs:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return started, nil
+}
+
+// stopService stops the input when it is a started service
+func stopService(input *models.RunningInput, started bool) {
+	if !started {
+		return
+	}
+	input.Input.(asgard.ServiceInput).Stop()
+	input.Log().Debugf("Service stopped")
+}
+
+// stopInputs stops the given gatherers and waits for them to return, then
+// stops the services among them
+func stopInputs(gatherers []*inputGatherer) {
+	for _, g := range gatherers {
+		close(g.stop)
+	}
+	for _, g := range gatherers {
+		<-g.done
+		stopService(g.input, g.service)
+	}
+}
+
 // Run runs the agent daemon, gathering every Interval
 func (a *Agent) Run(shutdown chan struct{}) error {
-	var wg sync.WaitGroup
+	a.mu.Lock()
+	if addr := a.Config.Agent.HealthListen; addr != "" {
+		if err := a.health.listen(addr); err != nil {
+			a.mu.Unlock()
+			return err
+		}
+	}
+	if addr := a.Config.Agent.AdminListen; addr != "" {
+		if err := a.admin.listen(addr); err != nil {
+			a.health.close()
+			a.mu.Unlock()
+			return err
+		}
+	}
+	a.mu.Unlock()
 
-	// channel shared between all input threads for accumulating metrics
-	metricChannel := make(chan asgard.Metric, 100)
+	var wg sync.WaitGroup
 
+	// the flusher is stopped after the inputs, so it takes the metrics
+	// gathered while the inputs are stopping
+	stopFlusher := make(chan struct{})
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := a.flusher(shutdown, metricChannel); err != nil {
-			log.Printf("ERROR Flusher routine failed, exiting: %s\n", err.Error())
+		if err := a.flusher(stopFlusher, a.metricC); err != nil {
+			log.Printf("E! Flusher routine failed, exiting: %s\n", err.Error())
 			close(shutdown)
 		}
 	}()
 
-	wg.Add(len(a.Config.Inputs))
-	for _, input := range a.Config.Inputs {
+	// aggregators are started before the inputs, so their first period is
+	// set once metrics arrive
+	a.mu.Lock()
+	for _, agg := range a.Config.Aggregators {
+		a.startAggregator(agg)
+	}
+	a.mu.Unlock()
 
-		// Set gatherer interval
-		interval := time.Duration(a.Config.Agent.Interval * time.Millisecond)
+	// services are started before the gatherers, so they are listening by
+	// the first gather
+	a.mu.RLock()
+	inputs := a.Config.Inputs
+	a.mu.RUnlock()
+	services, err := a.startServices(inputs)
+	if err != nil {
+		for input := range services {
+			stopService(input, true)
+		}
+		a.mu.Lock()
+		runners := a.aggregatorRunners
+		a.aggregatorRunners = nil
+		a.mu.Unlock()
+		stopAggregators(runners)
+		close(stopFlusher)
+		wg.Wait()
+		a.mu.Lock()
+		a.health.close()
+		a.admin.close()
+		a.mu.Unlock()
+		return err
+	}
 
-		go func(input *models.RunningInput, interval time.Duration) {
-			defer wg.Done()
-			a.gatherer(shutdown, input, interval, metricChannel)
-		}(input, interval)
+	a.mu.Lock()
+	a.running = true
+	for _, input := range a.Config.Inputs {
+		a.startInput(input, services[input])
 	}
+	a.mu.Unlock()
+
+	<-shutdown
+
+	a.mu.Lock()
+	a.running = false
+	gatherers := a.gatherers
+	a.gatherers = nil
+	runners := a.aggregatorRunners
+	a.aggregatorRunners = nil
+	a.health.close()
+	a.admin.close()
+	a.mu.Unlock()
+	stopInputs(gatherers)
+	// the aggregators push their current period once the inputs stopped
+	stopAggregators(runners)
 
+	close(stopFlusher)
 	wg.Wait()
 	a.Close()
 	return nil
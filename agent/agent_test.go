@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/plugins/aggregators"
+)
+
+// gatherInput adds the given metrics on every gather
+type gatherInput struct {
+	metrics []gatherMetric
+}
+
+type gatherMetric struct {
+	measurement string
+	fields      map[string]interface{}
+	tags        map[string]string
+	t           time.Time
+}
+
+func (*gatherInput) SampleConfig() string { return "" }
+func (*gatherInput) Description() string  { return "" }
+func (i *gatherInput) Gather(acc asgard.Accumulator) error {
+	for _, m := range i.metrics {
+		acc.AddFields(m.measurement, m.fields, m.tags, m.t)
+	}
+	return nil
+}
+
+func TestTestGather(t *testing.T) {
+	ts := time.Unix(1500000000, 123456789)
+
+	tests := []struct {
+		name      string
+		metrics   []gatherMetric
+		precision time.Duration
+		expected  []string
+	}{
+		{
+			name: "sorted tags and fields",
+			metrics: []gatherMetric{{
+				measurement: "cpu",
+				fields:      map[string]interface{}{"usage_user": 1.5, "usage_idle": 90, "state": "ok"},
+				tags:        map[string]string{"host": "a", "cpu": "cpu0"},
+				t:           ts,
+			}},
+			precision: time.Nanosecond,
+			expected:  []string{"cpu,cpu=cpu0,host=a state=\"ok\",usage_idle=90i,usage_user=1.5 1500000000123456789\n"},
+		},
+		{
+			name: "precision",
+			metrics: []gatherMetric{
+				{measurement: "a", fields: map[string]interface{}{"v": 1}, t: ts},
+				{measurement: "b", fields: map[string]interface{}{"v": 2}, t: ts},
+			},
+			precision: time.Second,
+			expected:  []string{"a v=1i 1500000000000000000\n", "b v=2i 1500000000000000000\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := models.NewRunningInput(&gatherInput{metrics: tt.metrics}, &models.InputConfig{Name: "gather"})
+			metrics, err := testGather(input, gatherSettings{timeout: time.Second, precision: tt.precision})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(metrics) != len(tt.expected) {
+				t.Fatalf("expected %d metrics, got %d", len(tt.expected), len(metrics))
+			}
+			for i, m := range metrics {
+				if m.String() != tt.expected[i] {
+					t.Errorf("expected %q, got %q", tt.expected[i], m.String())
+				}
+			}
+		})
+	}
+}
+
+func TestOnce(t *testing.T) {
+	ts := time.Unix(1500000000, 0)
+	metrics := func(name string) []gatherMetric {
+		return []gatherMetric{{measurement: name, fields: map[string]interface{}{"v": 1}, t: ts}}
+	}
+
+	tests := []struct {
+		name string
+		// errs are the write errors of the outputs
+		errs []error
+		// written are the measurements written to every output that
+		// doesn't fail, sorted
+		written []string
+		err     string
+	}{
+		{
+			name:    "every output",
+			errs:    []error{nil, nil},
+			written: []string{"a", "b"},
+		},
+		{
+			name:    "failed output",
+			errs:    []error{errors.New("unreachable"), nil},
+			written: []string{"a", "b"},
+			err:     "failed to write to test::0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.NewConfig()
+			c.Agent.OmitHostname = true
+			for _, name := range []string{"a", "b"} {
+				c.Inputs = append(c.Inputs, models.NewRunningInput(
+					&gatherInput{metrics: metrics(name)}, &models.InputConfig{Name: "gather", Alias: name}))
+			}
+			var outputs []*testOutput
+			for i, err := range tt.errs {
+				o := &testOutput{err: err}
+				outputs = append(outputs, o)
+				oc := &models.OutputConfig{Name: "test", Alias: strconv.Itoa(i)}
+				c.Outputs = append(c.Outputs, models.NewRunningOutput("test", o, oc, 0, 0))
+			}
+			defer c.UnregisterStats()
+
+			a, err := NewAgent(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = a.Once()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for i, o := range outputs {
+				if !o.closed {
+					t.Errorf("output %d: expected to be closed", i)
+				}
+				if tt.errs[i] != nil {
+					continue
+				}
+				var written []string
+				for _, m := range o.written {
+					written = append(written, m.Name())
+				}
+				sort.Strings(written)
+				if strings.Join(written, ",") != strings.Join(tt.written, ",") {
+					t.Errorf("output %d: expected %q written, got %q", i, tt.written, written)
+				}
+			}
+		})
+	}
+}
+
+func TestInputSettings(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.Interval.Duration = 10 * time.Second
+	c.Agent.RoundInterval = true
+	c.Agent.CollectionJitter.Duration = time.Second
+	c.Agent.Precision.Duration = time.Millisecond
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		config   models.InputConfig
+		expected gatherSettings
+	}{
+		{
+			name:     "agent settings",
+			expected: gatherSettings{interval: 10 * time.Second, timeout: 10 * time.Second, roundInterval: true, jitter: time.Second, precision: time.Millisecond},
+		},
+		{
+			name:     "input interval",
+			config:   models.InputConfig{Interval: time.Minute},
+			expected: gatherSettings{interval: time.Minute, timeout: time.Minute, roundInterval: true, jitter: time.Second, precision: time.Millisecond},
+		},
+		{
+			name:     "input timeout",
+			config:   models.InputConfig{Timeout: 5 * time.Second},
+			expected: gatherSettings{interval: 10 * time.Second, timeout: 5 * time.Second, roundInterval: true, jitter: time.Second, precision: time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Name = "settings"
+			input := models.NewRunningInput(&gatherInput{}, &config)
+			defer input.UnregisterStats()
+			if s := a.inputSettings(input); s != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, s)
+			}
+		})
+	}
+}
+
+// countAggregator pushes one metric per count, more than aggMetricC holds
+type countAggregator struct {
+	Count int `toml:"count"`
+}
+
+func (*countAggregator) SampleConfig() string { return "" }
+func (*countAggregator) Description() string  { return "" }
+func (*countAggregator) Add(in asgard.Metric) {}
+func (*countAggregator) Reset()               {}
+func (a *countAggregator) Push(acc asgard.Accumulator) {
+	for i := 0; i < a.Count; i++ {
+		acc.AddFields("count", map[string]interface{}{"i": i}, nil)
+	}
+}
+
+func init() {
+	aggregators.Add("count", func() asgard.Aggregator { return &countAggregator{} })
+}
+
+func TestRunShutdown(t *testing.T) {
+	c := loadConfig(t, `
+[[aggregators.count]]
+  period = "1h"
+  count = 250
+[[outputs.test]]
+`)
+	defer c.UnregisterStats()
+	a, err := NewAgent(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := c.Outputs[0].Output.(*testOutput)
+
+	shutdown := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- a.Run(shutdown)
+	}()
+	waitRunning(t, a)
+	close(shutdown)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent didn't stop")
+	}
+	// the period pushed on shutdown is written
+	if len(output.written) != 250 {
+		t.Errorf("expected 250 metrics written, got %d", len(output.written))
+	}
+}
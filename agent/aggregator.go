@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/models"
+)
+
+// aggregatorRunner is the goroutine pushing a running aggregator at the end
+// of every period
+type aggregatorRunner struct {
+	agg  *models.RunningAggregator
+	stop chan struct{}
+	done chan struct{}
+}
+
+// aggregators returns the aggregators the agent currently adds metrics to
+func (a *Agent) aggregators() []*models.RunningAggregator {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Config.Aggregators
+}
+
+// aggregate adds the metric to every aggregator, it returns true when the
+// metric must not be written to the outputs
+func aggregate(aggregators []*models.RunningAggregator, m asgard.Metric) bool {
+	var dropOriginal bool
+	for _, agg := range aggregators {
+		if agg.Add(m) {
+			dropOriginal = true
+		}
+	}
+	return dropOriginal
+}
+
+// startAggregator starts the first period of the aggregator and the
+// goroutine pushing it. Periods are aligned on multiples of the period when
+// round_interval is set. The caller must hold a.mu.
+func (a *Agent) startAggregator(agg *models.RunningAggregator) {
+	period := agg.Config.Period
+	start := time.Now()
+	if a.Config.Agent.RoundInterval {
+		start = start.Truncate(period)
+	}
+	agg.StartPeriod(start, start.Add(period))
+
+	r := &aggregatorRunner{
+		agg:  agg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		a.runAggregator(r.stop, agg)
+	}()
+	a.aggregatorRunners = append(a.aggregatorRunners, r)
+}
+
+// runAggregator pushes the aggregator once its period ended and the delay
+// passed, then starts the next period. The current period is pushed on
+// shutdown.
+func (a *Agent) runAggregator(shutdown chan struct{}, agg *models.RunningAggregator) {
+	for {
+		_, end := agg.Period()
+		timer := time.NewTimer(time.Until(end.Add(agg.Config.Delay)))
+		select {
+		case <-shutdown:
+			timer.Stop()
+			a.pushAggregator(agg)
+			return
+		case <-timer.C:
+			a.pushAggregator(agg)
+			agg.StartPeriod(end, end.Add(agg.Config.Period))
+		}
+	}
+}
+
+// pushAggregator pushes the aggregator and hands the metrics to the outputs.
+// The metrics are collected before they are handed on, the aggregator is
+// locked while it is pushed and the flusher may be waiting to add to it.
+func (a *Agent) pushAggregator(agg *models.RunningAggregator) {
+	metricC := make(chan asgard.Metric)
+	done := make(chan struct{})
+	var metrics []asgard.Metric
+	go func() {
+		for m := range metricC {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+
+	agg.Push(NewAccumulator(agg, metricC))
+	close(metricC)
+	<-done
+	for _, m := range metrics {
+		a.aggMetricC <- m
+	}
+}
+
+// stopAggregators stops the given runners, pushing the current period of
+// their aggregators, and waits for them to return
+func stopAggregators(runners []*aggregatorRunner) {
+	for _, r := range runners {
+		close(r.stop)
+	}
+	for _, r := range runners {
+		<-r.done
+	}
+}
+
+// findAggregator returns the index of the runner of the aggregator with the
+// given checksum, or -1
+func findAggregator(runners []*aggregatorRunner, checksum string) int {
+	for i, r := range runners {
+		if r.agg.Config.Checksum == checksum {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Status is the state of the agent served on /status
+type Status struct {
+	Inputs  []InputStatus  `json:"inputs"`
+	Outputs []OutputStatus `json:"outputs"`
+}
+
+// InputStatus is the state of an input instance
+type InputStatus struct {
+	Name          string     `json:"name"`
+	LastGather    *time.Time `json:"last_gather,omitempty"`
+	GatherTime    string     `json:"gather_time,omitempty"`
+	Errors        int64      `json:"errors"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// OutputStatus is the state of an output instance
+type OutputStatus struct {
+	Name         string     `json:"name"`
+	LastWrite    *time.Time `json:"last_write,omitempty"`
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	BufferSize   int        `json:"buffer_size"`
+	FailedSize   int        `json:"failed_size"`
+	BufferLimit  int        `json:"buffer_limit"`
+	Paused       bool       `json:"paused"`
+}
+
+// Health is the result of the health check served on /health
+type Health struct {
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// timePtr returns nil for the zero time, so it is left out of the JSON
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Status returns the state of every configured input and output
+func (a *Agent) Status() Status {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	s := Status{
+		Inputs:  make([]InputStatus, 0, len(a.Config.Inputs)),
+		Outputs: make([]OutputStatus, 0, len(a.Config.Outputs)),
+	}
+	for _, input := range a.Config.Inputs {
+		is := input.Status()
+		status := InputStatus{
+			Name:          is.Name,
+			LastGather:    timePtr(is.LastGather),
+			Errors:        is.Errors.Count,
+			LastErrorTime: timePtr(is.Errors.LastTime),
+		}
+		if !is.LastGather.IsZero() {
+			status.GatherTime = is.GatherTime.String()
+		}
+		if is.Errors.Last != nil {
+			status.LastError = is.Errors.Last.Error()
+		}
+		s.Inputs = append(s.Inputs, status)
+	}
+	for _, o := range a.Config.Outputs {
+		st := o.Status()
+		status := OutputStatus{
+			Name:         st.Name,
+			LastWrite:    timePtr(st.LastWrite),
+			FailingSince: timePtr(st.FailingSince),
+			BufferSize:   st.BufferSize,
+			FailedSize:   st.FailedSize,
+			BufferLimit:  st.BufferLimit,
+			Paused:       st.Paused,
+		}
+		if st.LastError != nil {
+			status.LastError = st.LastError.Error()
+		}
+		s.Outputs = append(s.Outputs, status)
+	}
+	return s
+}
+
+// Health checks the outputs of the agent. It fails when every write to an
+// output failed for longer than health_max_failing_time, or when the
+// metrics an output failed to write fill more than health_max_buffer_fill
+// of its buffer.
+func (a *Agent) Health() Health {
+	a.mu.RLock()
+	maxFailing := a.Config.Agent.HealthMaxFailingTime.Duration
+	maxFill := a.Config.Agent.HealthMaxBufferFill
+	outputs := a.Config.Outputs
+	a.mu.RUnlock()
+
+	h := Health{Status: "ok"}
+	now := time.Now()
+	for _, o := range outputs {
+		s := o.Status()
+		if maxFailing > 0 && !s.FailingSince.IsZero() && now.Sub(s.FailingSince) > maxFailing {
+			h.Problems = append(h.Problems, fmt.Sprintf("%s: writes failing since %s: %s",
+				s.Name, s.FailingSince.Format(time.RFC3339), s.LastError))
+		}
+		if maxFill > 0 && s.BufferLimit > 0 && float64(s.FailedSize)/float64(s.BufferLimit) > maxFill {
+			h.Problems = append(h.Problems, fmt.Sprintf("%s: %d of %d buffered metrics failed to be written",
+				s.Name, s.FailedSize, s.BufferLimit))
+		}
+	}
+	if len(h.Problems) > 0 {
+		h.Status = "failing"
+	}
+	return h
+}
+
+// healthHandler serves /health and /status
+func (a *Agent) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		h := a.Health()
+		code := http.StatusOK
+		if len(h.Problems) > 0 {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, h)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, a.Status())
+	})
+	return mux
+}
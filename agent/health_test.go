@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/metric"
+)
+
+// healthAgent returns an agent with one output, the metrics added to it are
+// written once and fail to be written with err
+func healthAgent(t *testing.T, err error, maxFailing time.Duration, maxFill float64) (*Agent, *models.RunningOutput) {
+	c := config.NewConfig()
+	c.Agent.OmitHostname = true
+	c.Agent.HealthMaxFailingTime.Duration = maxFailing
+	c.Agent.HealthMaxBufferFill = maxFill
+	ro := models.NewRunningOutput("test", &testOutput{err: err}, &models.OutputConfig{Name: "test", Alias: "health"}, 10, 10)
+	c.Outputs = append(c.Outputs, ro)
+	a, aErr := NewAgent(c)
+	if aErr != nil {
+		t.Fatal(aErr)
+	}
+
+	m, mErr := metric.New("m", nil, map[string]interface{}{"v": 1}, time.Now())
+	if mErr != nil {
+		t.Fatal(mErr)
+	}
+	ro.AddMetric(m)
+	ro.Write()
+	return a, ro
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		maxFailing time.Duration
+		maxFill    float64
+		code       int
+		problem    string
+	}{
+		{
+			name:       "ok",
+			maxFailing: time.Nanosecond,
+			maxFill:    0.01,
+			code:       http.StatusOK,
+		},
+		{
+			name:       "failing writes",
+			err:        errors.New("unreachable"),
+			maxFailing: time.Nanosecond,
+			code:       http.StatusServiceUnavailable,
+			problem:    "outputs.test::health: writes failing since",
+		},
+		{
+			name:    "buffer fill",
+			err:     errors.New("unreachable"),
+			maxFill: 0.05,
+			code:    http.StatusServiceUnavailable,
+			problem: "outputs.test::health: 1 of 10 buffered metrics failed to be written",
+		},
+		{
+			name: "checks disabled",
+			err:  errors.New("unreachable"),
+			code: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ro := healthAgent(t, tt.err, tt.maxFailing, tt.maxFill)
+			defer ro.UnregisterStats()
+			time.Sleep(time.Millisecond)
+
+			w := httptest.NewRecorder()
+			a.healthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+			if w.Code != tt.code {
+				t.Errorf("expected status %d, got %d", tt.code, w.Code)
+			}
+			var h Health
+			if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+				t.Fatal(err)
+			}
+			if tt.problem == "" {
+				if h.Status != "ok" || len(h.Problems) > 0 {
+					t.Errorf("expected ok, got %+v", h)
+				}
+				return
+			}
+			if h.Status != "failing" || len(h.Problems) != 1 || !strings.HasPrefix(h.Problems[0], tt.problem) {
+				t.Errorf("expected failing with %q, got %+v", tt.problem, h)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	a, ro := healthAgent(t, errors.New("unreachable"), 0, 0)
+	defer ro.UnregisterStats()
+
+	w := httptest.NewRecorder()
+	a.healthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	var s Status
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Outputs) != 1 {
+		t.Fatalf("expected 1 output, got %+v", s.Outputs)
+	}
+	o := s.Outputs[0]
+	if o.Name != "outputs.test::health" || o.LastError != "unreachable" || o.FailingSince == nil ||
+		o.LastWrite != nil || o.FailedSize != 1 || o.BufferSize != 1 || o.BufferLimit != 10 {
+		t.Errorf("unexpected output status %+v", o)
+	}
+}
@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/internal/secrets"
+)
+
+// Reload applies the given config to the running agent.
+// Inputs, outputs and aggregators whose settings did not change keep running,
+// outputs keep their buffered metrics and aggregators their current period.
+// Removed and changed plugins are stopped, the buffered metrics of removed
+// outputs are flushed before they are closed, removed aggregators push their
+// current period, and new plugins are started. When the [Agent] settings or
+// the global tags change, every input and aggregator is restarted.
+// If a new output fails to connect the agent is left untouched.
+func (a *Agent) Reload(newConfig *config.Config) error {
+	if err := prepareConfig(newConfig); err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	oldConfig := a.Config
+	a.mu.RUnlock()
+
+	// new outputs may need the new stores to connect
+	secrets.SetStores(newConfig.SecretStores)
+
+	agentChanged := !reflect.DeepEqual(oldConfig.Agent, newConfig.Agent) ||
+		!reflect.DeepEqual(oldConfig.Tags, newConfig.Tags)
+
+	// Outputs
+	oldOutputs := make([]*models.RunningOutput, len(oldConfig.Outputs))
+	copy(oldOutputs, oldConfig.Outputs)
+	// discardedOutputs are the new outputs replaced by the running ones
+	var addedOutputs, discardedOutputs []*models.RunningOutput
+	for i, o := range newConfig.Outputs {
+		if j := findOutput(oldOutputs, o.Config.Checksum); j >= 0 {
+			discardedOutputs = append(discardedOutputs, o)
+			newConfig.Outputs[i] = oldOutputs[j]
+			oldOutputs = append(oldOutputs[:j], oldOutputs[j+1:]...)
+			continue
+		}
+		addedOutputs = append(addedOutputs, o)
+	}
+	for i, o := range addedOutputs {
+		if err := connectOutput(o); err != nil {
+			for _, connected := range addedOutputs[:i] {
+				connected.Output.Close()
+			}
+			secrets.SetStores(oldConfig.SecretStores)
+			unregisterOutputs(addedOutputs)
+			unregisterOutputs(discardedOutputs)
+			for _, input := range newConfig.Inputs {
+				input.UnregisterStats()
+			}
+			for _, agg := range newConfig.Aggregators {
+				agg.UnregisterStats()
+			}
+			return err
+		}
+	}
+	unregisterOutputs(discardedOutputs)
+	removedOutputs := oldOutputs
+
+	// Inputs
+	a.mu.Lock()
+	oldGatherers := a.gatherers
+	a.gatherers = nil
+	a.Config = newConfig
+	var addedInputs []*models.RunningInput
+	for i, input := range newConfig.Inputs {
+		if j := findGatherer(oldGatherers, input.Config.Checksum); j >= 0 && !agentChanged {
+			input.UnregisterStats()
+			newConfig.Inputs[i] = oldGatherers[j].input
+			a.gatherers = append(a.gatherers, oldGatherers[j])
+			oldGatherers = append(oldGatherers[:j], oldGatherers[j+1:]...)
+			continue
+		}
+		addedInputs = append(addedInputs, input)
+	}
+	running := a.running
+
+	// Aggregators are started right away, so their period is set before
+	// the flusher adds metrics to them
+	oldRunners := a.aggregatorRunners
+	a.aggregatorRunners = nil
+	var addedAggregators []*models.RunningAggregator
+	for i, agg := range newConfig.Aggregators {
+		if j := findAggregator(oldRunners, agg.Config.Checksum); j >= 0 && !agentChanged {
+			agg.UnregisterStats()
+			newConfig.Aggregators[i] = oldRunners[j].agg
+			a.aggregatorRunners = append(a.aggregatorRunners, oldRunners[j])
+			oldRunners = append(oldRunners[:j], oldRunners[j+1:]...)
+			continue
+		}
+		addedAggregators = append(addedAggregators, agg)
+		if running {
+			a.startAggregator(agg)
+		}
+	}
+	a.mu.Unlock()
+
+	// removed services are stopped before new ones start, a changed service
+	// may listen on the same address
+	stopInputs(oldGatherers)
+	stopAggregators(oldRunners)
+	unregisterRemoved(oldConfig, newConfig)
+	var services map[*models.RunningInput]bool
+	if running {
+		var err error
+		services, err = a.startServices(addedInputs)
+		if err != nil {
+			log.Printf("E! %s", err)
+		}
+	}
+
+	a.mu.Lock()
+	if a.running {
+		for _, input := range addedInputs {
+			a.startInput(input, services[input])
+		}
+		a.health.reload(newConfig.Agent.HealthListen)
+		a.admin.reload(newConfig.Agent.AdminListen)
+	} else {
+		// the agent shut down meanwhile
+		for input := range services {
+			stopService(input, true)
+		}
+	}
+	a.mu.Unlock()
+
+	if agentChanged {
+		select {
+		case a.reloadC <- struct{}{}:
+		default:
+		}
+	}
+
+	flushOutputs(removedOutputs)
+	for _, o := range removedOutputs {
+		if err := o.Output.Close(); err != nil {
+			log.Printf("E! [outputs.%s] Error closing output: %s", o.Name, err)
+		}
+	}
+	unregisterOutputs(removedOutputs)
+
+	log.Printf("I! Config reloaded: %d inputs started, %d stopped, %d outputs started, %d stopped, %d aggregators started, %d stopped\n",
+		len(addedInputs), len(oldGatherers), len(addedOutputs), len(removedOutputs), len(addedAggregators), len(oldRunners))
+	return nil
+}
+
+// unregisterOutputs unregisters the stats of outputs that were closed or
+// discarded
+func unregisterOutputs(outputs []*models.RunningOutput) {
+	for _, o := range outputs {
+		o.UnregisterStats()
+	}
+}
+
+// unregisterRemoved unregisters the stats of the inputs and aggregators of
+// oldConfig that newConfig doesn't keep
+func unregisterRemoved(oldConfig, newConfig *config.Config) {
+	kept := make(map[interface{}]bool)
+	for _, input := range newConfig.Inputs {
+		kept[input] = true
+	}
+	for _, agg := range newConfig.Aggregators {
+		kept[agg] = true
+	}
+	for _, input := range oldConfig.Inputs {
+		if !kept[input] {
+			input.UnregisterStats()
+		}
+	}
+	for _, agg := range oldConfig.Aggregators {
+		if !kept[agg] {
+			agg.UnregisterStats()
+		}
+	}
+}
+
+// findOutput returns the index of the output with the given checksum, or -1
+func findOutput(outputs []*models.RunningOutput, checksum string) int {
+	for i, o := range outputs {
+		if o.Config.Checksum == checksum {
+			return i
+		}
+	}
+	return -1
+}
+
+// findGatherer returns the index of the gatherer of the input with the given
+// checksum, or -1
+func findGatherer(gatherers []*inputGatherer, checksum string) int {
+	for i, g := range gatherers {
+		if g.input.Config.Checksum == checksum {
+			return i
+		}
+	}
+	return -1
+}
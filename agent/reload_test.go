@@ -0,0 +1,248 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/plugins/inputs"
+	"github.com/anabiozz/asgard/plugins/outputs"
+)
+
+// testInput and testOutput are registered for the agent tests only
+type testInput struct {
+	Port int `toml:"port"`
+}
+
+func (*testInput) SampleConfig() string                { return "" }
+func (*testInput) Description() string                 { return "" }
+func (*testInput) Gather(acc asgard.Accumulator) error { return nil }
+
+type testOutput struct {
+	URL string `toml:"url"`
+
+	connected bool
+	closed    bool
+	// written are the metrics written, writes fail with err
+	written []asgard.Metric
+	err     error
+}
+
+func (o *testOutput) Connect() error { o.connected = true; return nil }
+func (o *testOutput) Close() error   { o.closed = true; return nil }
+func (o *testOutput) Write(metrics []asgard.Metric) error {
+	if o.err != nil {
+		return o.err
+	}
+	o.written = append(o.written, metrics...)
+	return nil
+}
+func (*testOutput) Description() string  { return "" }
+func (*testOutput) SampleConfig() string { return "" }
+
+func init() {
+	inputs.Add("test", func() asgard.Input { return &testInput{} })
+	outputs.Add("test", func() asgard.Output { return &testOutput{} })
+}
+
+// loadConfig loads the given contents as a config file
+func loadConfig(t *testing.T, contents string) *config.Config {
+	dir, err := ioutil.TempDir("", "asgard-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asgard.toml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := config.NewConfig()
+	c.Agent.Hostname = "test"
+	if err := c.LoadConfig(path, ""); err != nil {
+		t.Fatalf("Error loading config: %s", err)
+	}
+	return c
+}
+
+// waitRunning waits for the agent to start its inputs
+func waitRunning(t *testing.T, a *Agent) {
+	for i := 0; i < 100; i++ {
+		a.mu.RLock()
+		running := a.running
+		a.mu.RUnlock()
+		if running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("agent didn't start")
+}
+
+func TestReload(t *testing.T) {
+	old := `
+[[inputs.test]]
+  port = 1
+[[inputs.test]]
+  port = 2
+[[outputs.test]]
+  url = "a"
+[[outputs.test]]
+  url = "b"
+`
+
+	tests := []struct {
+		name     string
+		contents string
+		// keptInputs and keptOutputs tell for every plugin of the new
+		// config whether the running one was kept
+		keptInputs  []bool
+		keptOutputs []bool
+		// closed are the urls of the outputs closed by the reload
+		closed []string
+	}{
+		{
+			name:        "unchanged",
+			contents:    old,
+			keptInputs:  []bool{true, true},
+			keptOutputs: []bool{true, true},
+		},
+		{
+			name: "changed input",
+			contents: `
+[[inputs.test]]
+  port = 1
+[[inputs.test]]
+  port = 3
+[[outputs.test]]
+  url = "a"
+[[outputs.test]]
+  url = "b"
+`,
+			keptInputs:  []bool{true, false},
+			keptOutputs: []bool{true, true},
+		},
+		{
+			name: "removed and added outputs",
+			contents: `
+[[inputs.test]]
+  port = 1
+[[inputs.test]]
+  port = 2
+[[outputs.test]]
+  url = "a"
+[[outputs.test]]
+  url = "c"
+`,
+			keptInputs:  []bool{true, true},
+			keptOutputs: []bool{true, false},
+			closed:      []string{"b"},
+		},
+		{
+			name: "moved output",
+			contents: `
+[[inputs.test]]
+  port = 1
+[[inputs.test]]
+  port = 2
+[[outputs.test]]
+  url = "b"
+`,
+			keptInputs:  []bool{true, true},
+			keptOutputs: []bool{false},
+			closed:      []string{"a", "b"},
+		},
+		{
+			name: "changed agent settings",
+			contents: `
+[Agent]
+  interval = "5s"
+` + old,
+			keptInputs:  []bool{false, false},
+			keptOutputs: []bool{true, true},
+		},
+		{
+			name: "changed buffer settings",
+			contents: `
+[Agent]
+  metric_batch_size = 10
+` + old,
+			keptInputs:  []bool{false, false},
+			keptOutputs: []bool{false, false},
+			closed:      []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldConfig := loadConfig(t, old)
+			a, err := NewAgent(oldConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldInputs := oldConfig.Inputs
+			oldOutputs := oldConfig.Outputs
+
+			shutdown := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				a.Run(shutdown)
+			}()
+			defer func() {
+				close(shutdown)
+				<-done
+			}()
+			waitRunning(t, a)
+
+			newConfig := loadConfig(t, tt.contents)
+			if err := a.Reload(newConfig); err != nil {
+				t.Fatalf("Error reloading: %s", err)
+			}
+			if a.Config != newConfig {
+				t.Fatal("expected the new config to be applied")
+			}
+
+			for i, input := range newConfig.Inputs {
+				kept := false
+				for _, o := range oldInputs {
+					kept = kept || o == input
+				}
+				if kept != tt.keptInputs[i] {
+					t.Errorf("input %d: expected kept %v, got %v", i, tt.keptInputs[i], kept)
+				}
+			}
+			for i, output := range newConfig.Outputs {
+				kept := false
+				for _, o := range oldOutputs {
+					kept = kept || o == output
+				}
+				if kept != tt.keptOutputs[i] {
+					t.Errorf("output %d: expected kept %v, got %v", i, tt.keptOutputs[i], kept)
+				}
+				if !kept && !output.Output.(*testOutput).connected {
+					t.Errorf("output %d: expected the new output to be connected", i)
+				}
+			}
+
+			var closed []string
+			for _, o := range oldOutputs {
+				if output := o.Output.(*testOutput); output.closed {
+					closed = append(closed, output.URL)
+				}
+			}
+			if len(closed) != len(tt.closed) {
+				t.Fatalf("expected %q to be closed, got %q", tt.closed, closed)
+			}
+			for i := range closed {
+				if closed[i] != tt.closed[i] {
+					t.Errorf("expected %q to be closed, got %q", tt.closed, closed)
+				}
+			}
+		})
+	}
+}
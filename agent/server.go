@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// server is an HTTP server the agent runs while it is running, such as the
+// health and the admin listener
+type server struct {
+	// name describes the server in logs
+	name    string
+	handler http.Handler
+	// loopbackOnly refuses TCP addresses other machines can reach
+	loopbackOnly bool
+
+	addr string
+	srv  *http.Server
+}
+
+// listen starts serving on addr, either "host:port" or "unix:///path/to/socket"
+func (s *server) listen(addr string) error {
+	l, err := listenAddr(addr, s.loopbackOnly)
+	if err != nil {
+		return fmt.Errorf("Error starting %s listener: %s", s.name, err)
+	}
+	srv := &http.Server{Handler: s.handler}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("E! %s listener on %s failed: %s", s.name, addr, err)
+		}
+	}()
+	log.Printf("I! Serving %s on %s", s.name, addr)
+	s.srv, s.addr = srv, addr
+	return nil
+}
+
+// reload moves the server to addr when it changed, it is stopped when addr
+// is empty
+func (s *server) reload(addr string) {
+	if addr == s.addr {
+		return
+	}
+	s.close()
+	if addr == "" {
+		return
+	}
+	if err := s.listen(addr); err != nil {
+		log.Printf("E! %s", err)
+	}
+}
+
+// close stops the server. It stops listening right away, requests in
+// progress, such as the admin request that caused a reload, are completed.
+func (s *server) close() {
+	if s.srv != nil {
+		go s.srv.Shutdown(context.Background())
+	}
+	s.srv, s.addr = nil, ""
+}
+
+// listenAddr listens on a "unix://" socket path or on a TCP address. A
+// stale socket file left by a previous run is removed, the socket is only
+// accessible by the user running the agent.
+func listenAddr(addr string, loopbackOnly bool) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix://") {
+		return listenUnix(strings.TrimPrefix(addr, "unix://"))
+	}
+
+	if loopbackOnly {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if host != "localhost" {
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsLoopback() {
+				return nil, fmt.Errorf("%s is not a loopback address", addr)
+			}
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on the socket at path. The socket is created in a
+// private directory and only moved to path once its mode is 0600, so other
+// users can't connect before the mode is set.
+func listenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		os.Remove(path)
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".asgard-socket")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// the socket file is removed by unixListener once it was moved
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: l, path: path}, nil
+}
+
+// unixListener removes its socket file when it is closed
+type unixListener struct {
+	net.Listener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
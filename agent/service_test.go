@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/plugins/inputs"
+)
+
+// serviceInput records when it is started and stopped, Start fails with fail
+type serviceInput struct {
+	Port int  `toml:"port"`
+	Fail bool `toml:"fail"`
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+}
+
+func (*serviceInput) SampleConfig() string                { return "" }
+func (*serviceInput) Description() string                 { return "" }
+func (*serviceInput) Gather(acc asgard.Accumulator) error { return nil }
+func (s *serviceInput) Start(acc asgard.Accumulator) error {
+	if s.Fail {
+		return errors.New("address in use")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+	return nil
+}
+func (s *serviceInput) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+}
+
+// state returns whether the service was started and stopped
+func (s *serviceInput) state() (started, stopped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started, s.stopped
+}
+
+func init() {
+	inputs.Add("service", func() asgard.Input { return &serviceInput{} })
+}
+
+// services returns the service inputs of the agent by port
+func services(a *Agent) map[int]*serviceInput {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	s := make(map[int]*serviceInput)
+	for _, input := range a.Config.Inputs {
+		if service, ok := input.Input.(*serviceInput); ok {
+			s[service.Port] = service
+		}
+	}
+	return s
+}
+
+func TestServiceInputs(t *testing.T) {
+	a, err := NewAgent(loadConfig(t, `
+[[inputs.service]]
+  port = 1
+[[inputs.service]]
+  port = 2
+[[outputs.test]]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutdown := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- a.Run(shutdown) }()
+	waitRunning(t, a)
+	old := services(a)
+
+	if err := a.Reload(loadConfig(t, `
+[[inputs.service]]
+  port = 1
+[[inputs.service]]
+  port = 3
+[[outputs.test]]
+`)); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := services(a)
+	if reloaded[1] != old[1] {
+		t.Error("expected the unchanged service to keep running")
+	}
+
+	type state struct {
+		service *serviceInput
+		started bool
+		stopped bool
+	}
+	check := func(step string, states map[string]state) {
+		for name, s := range states {
+			if s.service == nil {
+				t.Fatalf("%s: missing %s service", step, name)
+			}
+			if started, stopped := s.service.state(); started != s.started || stopped != s.stopped {
+				t.Errorf("%s: expected the %s service started %v and stopped %v, got %v and %v",
+					step, name, s.started, s.stopped, started, stopped)
+			}
+		}
+	}
+	check("reload", map[string]state{
+		"kept":    {service: reloaded[1], started: true},
+		"removed": {service: old[2], started: true, stopped: true},
+		"added":   {service: reloaded[3], started: true},
+	})
+
+	close(shutdown)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	check("shutdown", map[string]state{
+		"kept":  {service: reloaded[1], started: true, stopped: true},
+		"added": {service: reloaded[3], started: true, stopped: true},
+	})
+}
+
+func TestServiceInputsFailedStart(t *testing.T) {
+	a, err := NewAgent(loadConfig(t, `
+[[inputs.service]]
+  port = 1
+[[inputs.service]]
+  port = 2
+  fail = true
+[[outputs.test]]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Run(make(chan struct{}))
+	if err == nil || !strings.Contains(err.Error(), "address in use") {
+		t.Fatalf("expected the start error, got %v", err)
+	}
+	if started, stopped := services(a)[1].state(); !started || !stopped {
+		t.Errorf("expected the started service to be stopped, got started %v and stopped %v", started, stopped)
+	}
+}
@@ -0,0 +1,21 @@
+package asgard
+
+// Aggregator computes metrics over a period from the metrics gathered by the
+// inputs, ie the mean of a field. Every period the agent calls Push and then
+// Reset.
+type Aggregator interface {
+	// SampleConfig returns the default configuration of the Aggregator
+	SampleConfig() string
+
+	// Description returns a one-sentence description on the Aggregator
+	Description() string
+
+	// Add adds a metric to the aggregation, the metric must not be modified
+	Add(in Metric)
+
+	// Push adds the aggregated metrics of the period to acc
+	Push(acc Accumulator)
+
+	// Reset clears the aggregation, it is called after Push
+	Reset()
+}
@@ -0,0 +1,11 @@
+package asgard
+
+// Initializer is implemented by plugins and serializers that check their
+// settings once the config was decoded, ie parse URLs, compile patterns or
+// load TLS files. Init errors are reported at startup together with the
+// other errors of the config. Init is also called for the plugins of a
+// config that is only checked, it must not connect to anything.
+type Initializer interface {
+	// Init checks the settings and prepares the plugin
+	Init() error
+}
@@ -1,5 +1,7 @@
 package asgard
 
+import "context"
+
 type Input interface {
 	// SampleConfig returns the default configuration of the Input
 	SampleConfig() string
@@ -11,3 +13,29 @@ type Input interface {
 	// gathers. This is called every "interval"
 	Gather(Accumulator) error
 }
+
+// ContextInput is an Input whose gather can be cancelled. The agent calls
+// GatherContext instead of Gather, ctx is cancelled once the timeout of the
+// input expires or the agent shuts down.
+type ContextInput interface {
+	Input
+
+	// GatherContext is Gather, returning early once ctx is done
+	GatherContext(ctx context.Context, acc Accumulator) error
+}
+
+// ServiceInput is an Input that runs in the background, ie a listener that
+// receives metrics pushed to it. The agent starts it before gathering and
+// stops it on shutdown and when the input is removed or changed by a reload.
+// Gather is still called every interval.
+type ServiceInput interface {
+	Input
+
+	// Start starts the service, metrics are added to acc as they arrive.
+	// Timestamps given to acc are kept as is, the agent precision isn't
+	// applied to them.
+	Start(acc Accumulator) error
+
+	// Stop stops the service and closes any connections
+	Stop()
+}
@@ -51,8 +51,10 @@ func min(a, b int) int {
 	return a
 }
 
-// Add adds metrics to the buffer.
-func (b *Buffer) Add(metrics ...asgard.Metric) {
+// Add adds metrics to the buffer. It returns the number of metrics dropped
+// to make room for them.
+func (b *Buffer) Add(metrics ...asgard.Metric) int {
+	dropped := 0
 	for i, _ := range metrics {
 		select {
 		case b.buf <- metrics[i]:
@@ -61,6 +63,8 @@ func (b *Buffer) Add(metrics ...asgard.Metric) {
 			<-b.buf
 			b.buf <- metrics[i]
 			b.mu.Unlock()
+			dropped++
 		}
 	}
+	return dropped
 }
\ No newline at end of file
@@ -1,13 +1,29 @@
 package config
 
 import (
-	"flag"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal"
 	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/internal/secrets"
+	"github.com/anabiozz/asgard/plugins/aggregators"
 	"github.com/anabiozz/asgard/plugins/inputs"
 	"github.com/anabiozz/asgard/plugins/outputs"
+	"github.com/anabiozz/asgard/plugins/processors"
+	"github.com/anabiozz/asgard/plugins/secretstores"
 	"github.com/anabiozz/asgard/plugins/serializers"
 	"github.com/anabiozz/asgard/utils"
 
@@ -18,8 +34,124 @@ const (
 	envConfigPath = "DEFAULT_CONFIG"
 )
 
+var (
+	// envVarRe matches a ${VAR} or ${VAR:-default} reference
+	envVarRe = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+	// fileRe matches a @file:/path reference, the path ends at the first
+	// quote or whitespace
+	fileRe = regexp.MustCompile(`^@file:([^\s"']+)`)
+
+	// bareValueRe matches the values that may be interpolated outside of a
+	// string: numbers, booleans and dates
+	bareValueRe = regexp.MustCompile(`^[A-Za-z0-9_.:+-]+$`)
+)
+
+// tomlConfig is the layout of the config file. Plugin tables are kept as
+// primitives and decoded once the plugin they belong to has been created.
 type tomlConfig struct {
-	c AgentConfig `toml:"agent_config"`
+	Agent         *AgentConfig
+	Tags          map[string]string
+	InputFilters  map[string]interface{}
+	OutputFilters map[string]interface{}
+
+	Inputs       map[string][]toml.Primitive `toml:"inputs"`
+	Outputs      map[string][]toml.Primitive `toml:"outputs"`
+	Processors   map[string][]toml.Primitive `toml:"processors"`
+	Aggregators  map[string][]toml.Primitive `toml:"aggregators"`
+	SecretStores map[string][]toml.Primitive `toml:"secretstores"`
+}
+
+// secretStoreTable holds the settings every [[secretstores.<name>]] table
+// accepts next to the options of the store itself.
+type secretStoreTable struct {
+	// ID is the name plugins reference the store by, ie @{<id>:<key>}
+	ID string `toml:"id"`
+}
+
+// inputTable holds the settings every [[inputs.<name>]] table accepts next to
+// the options of the plugin itself.
+type inputTable struct {
+	// Alias names the plugin instance, so several instances of the same
+	// plugin can be told apart in logs and errors.
+	Alias string `toml:"alias"`
+
+	// Interval overrides the agent interval for this input
+	Interval internal.Duration `toml:"interval"`
+
+	// Timeout limits how long a gather may take, it defaults to the interval
+	Timeout internal.Duration `toml:"timeout"`
+
+	NameOverride string            `toml:"name_override"`
+	NamePrefix   string            `toml:"name_prefix"`
+	NameSuffix   string            `toml:"name_suffix"`
+	Tags         map[string]string `toml:"tags"`
+}
+
+// outputTable holds the settings every [[outputs.<name>]] table accepts next
+// to the options of the plugin itself.
+type outputTable struct {
+	// Alias names the plugin instance, see inputTable
+	Alias string `toml:"alias"`
+}
+
+// processorTable holds the settings every [[processors.<name>]] table
+// accepts next to the options of the plugin itself.
+type processorTable struct {
+	// Alias names the plugin instance, see inputTable
+	Alias string `toml:"alias"`
+
+	// Order places the processor among the others, processors run by
+	// increasing order, then in the order of their tables
+	Order int64 `toml:"order"`
+}
+
+// aggregatorTable holds the settings every [[aggregators.<name>]] table
+// accepts next to the options of the plugin itself.
+type aggregatorTable struct {
+	// Alias names the plugin instance, see inputTable
+	Alias string `toml:"alias"`
+
+	// Period is the length of the periods aggregated
+	Period internal.Duration `toml:"period"`
+	// Delay is how long late metrics are waited for after a period ended
+	Delay internal.Duration `toml:"delay"`
+	// Grace accepts metrics older than the current period into it
+	Grace internal.Duration `toml:"grace"`
+	// DropOriginal keeps the aggregated metrics from the outputs
+	DropOriginal bool `toml:"drop_original"`
+
+	NameOverride string            `toml:"name_override"`
+	NamePrefix   string            `toml:"name_prefix"`
+	NameSuffix   string            `toml:"name_suffix"`
+	Tags         map[string]string `toml:"tags"`
+}
+
+// processorFilterTable holds the filter settings of a processor table, they
+// select the metrics the processor is applied to
+type processorFilterTable struct {
+	NamePass []string            `toml:"namepass"`
+	NameDrop []string            `toml:"namedrop"`
+	TagPass  map[string][]string `toml:"tagpass"`
+	TagDrop  map[string][]string `toml:"tagdrop"`
+}
+
+// filterTable holds the metric filter settings of a plugin table. Tag
+// filters are given as sub-tables, ie [inputs.cpu.tagpass] cpu = ["cpu0"]
+type filterTable struct {
+	NamePass   []string            `toml:"namepass"`
+	NameDrop   []string            `toml:"namedrop"`
+	FieldPass  []string            `toml:"fieldpass"`
+	FieldDrop  []string            `toml:"fielddrop"`
+	TagPass    map[string][]string `toml:"tagpass"`
+	TagDrop    map[string][]string `toml:"tagdrop"`
+	TagInclude []string            `toml:"taginclude"`
+	TagExclude []string            `toml:"tagexclude"`
+}
+
+// serializerTable holds the serializer settings of an output table
+type serializerTable struct {
+	DataFormat string `toml:"data_format"`
 }
 
 type duration struct {
@@ -32,10 +164,23 @@ func (d *duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+// durationKeys are the [Agent] settings given as duration strings. Numbers
+// are rejected, they used to be milliseconds while internal.Duration reads
+// them as seconds.
+var durationKeys = map[string]bool{
+	"interval":          true,
+	"precision":         true,
+	"collection_jitter": true,
+	"flush_interval":    true,
+	"flush_jitter":      true,
+
+	"health_max_failing_time": true,
+}
+
 // AgentConfig ...
 type AgentConfig struct {
 	// Interval at which to gather information
-	Interval time.Duration `toml:"interval"`
+	Interval internal.Duration `toml:"interval"`
 
 	// RoundInterval rounds collection interval to 'interval'.
 	//     ie, if Interval=10s then always collect on :00, :10, :20, etc.
@@ -47,22 +192,22 @@ type AgentConfig struct {
 	//       when interval = "250ms", precision will be "1ms"
 	// Precision will NOT be used for service inputs. It is up to each individual
 	// service input to set the timestamp at the appropriate precision.
-	Precision int `toml:"precision"`
+	Precision internal.Duration `toml:"precision"`
 
 	// CollectionJitter is used to jitter the collection by a random amount.
 	// Each plugin will sleep for a random time within jitter before collecting.
 	// This can be used to avoid many plugins querying things like sysfs at the
 	// same time, which can have a measurable effect on the system.
-	CollectionJitter int `toml:"collection_jitter"`
+	CollectionJitter internal.Duration `toml:"collection_jitter"`
 
 	// FlushInterval is the Interval at which to flush data
-	FlushInterval time.Duration `toml:"flush_interval"`
+	FlushInterval internal.Duration `toml:"flush_interval"`
 
 	// FlushJitter Jitters the flush interval by a random amount.
 	// This is primarily to avoid large write spikes for users running a large
 	// number of  instances.
 	// ie, a jitter of 5s and interval 10s means flushes will happen every 10-15s
-	FlushJitter int `toml:"flush_jitter"`
+	FlushJitter internal.Duration `toml:"flush_jitter"`
 
 	// MetricBatchSize is the maximum number of metrics that is wrote to an
 	// output plugin in one call.
@@ -78,7 +223,7 @@ type AgentConfig struct {
 	// FlushBufferWhenFull tells  to flush the metric buffer whenever
 	// it fills up, regardless of FlushInterval. Setting this option to true
 	// does _not_ deactivate FlushInterval.
-	FlushBufferWhenFull bool `toml:"flush_buffer_when_dull"`
+	FlushBufferWhenFull bool `toml:"flush_buffer_when_full"`
 
 	// Debug is the option for running in debug mode
 	Debug bool `toml:"debug"`
@@ -86,10 +231,37 @@ type AgentConfig struct {
 	// Logfile specifies the file to send logs to
 	Logfile string `toml:"logfile"`
 
+	// LogfileRotationMaxSize rotates the logfile once it reaches the size,
+	// ie "10MB". Rotation is disabled when zero.
+	LogfileRotationMaxSize internal.Size `toml:"logfile_rotation_max_size"`
+
+	// LogfileRotationMaxArchives is the number of rotated logfiles kept
+	LogfileRotationMaxArchives int `toml:"logfile_rotation_max_archives"`
+
+	// LogFormat is "text" or "json"
+	LogFormat string `toml:"log_format"`
+
 	// Quiet is the option for running in quiet mode
 	Quiet        bool   `toml:"quiet"`
 	Hostname     string `toml:"hostname"`
 	OmitHostname bool   `toml:"omit_hostname"`
+
+	// HealthListen is the address of the HTTP listener serving /health and
+	// /status, ie "localhost:8125". There is no listener when empty.
+	HealthListen string `toml:"health_listen"`
+
+	// HealthMaxFailingTime fails /health once every write to an output
+	// failed for longer than the duration. Disabled when zero.
+	HealthMaxFailingTime internal.Duration `toml:"health_max_failing_time"`
+
+	// HealthMaxBufferFill fails /health once the metrics an output failed to
+	// write fill more than the ratio of its buffer. Disabled when zero.
+	HealthMaxBufferFill float64 `toml:"health_max_buffer_fill"`
+
+	// AdminListen is the address of the admin API, a unix socket given as
+	// "unix:///path/to/socket" or a loopback address such as
+	// "localhost:8126". There is no admin API when empty.
+	AdminListen string `toml:"admin_listen"`
 }
 
 // Config struct
@@ -98,43 +270,265 @@ type Config struct {
 	InputFilters  map[string]interface{}
 	OutputFilters map[string]interface{}
 
+	// SelectedInputs and SelectedOutputs, when set before loading, replace
+	// the [InputFilters] / [OutputFilters] lists: only the plugins named are
+	// created, from their tables when the config has any.
+	SelectedInputs  []string
+	SelectedOutputs []string
+
 	Agent   *AgentConfig
 	Inputs  []*models.RunningInput
 	Outputs []*models.RunningOutput
+	// Processors are sorted in the order they are applied
+	Processors  []*models.RunningProcessor
+	Aggregators []*models.RunningAggregator
+
+	// SecretStores are the configured secret stores by id
+	SecretStores map[string]asgard.SecretStore
 }
 
 // NewConfig return new config
 func NewConfig() *Config {
 	c := &Config{
-		Agent:         &AgentConfig{},
+		Agent: &AgentConfig{
+			Interval:      internal.Duration{Duration: 10 * time.Second},
+			RoundInterval: true,
+			FlushInterval: internal.Duration{Duration: 10 * time.Second},
+
+			LogfileRotationMaxArchives: 5,
+
+			HealthMaxFailingTime: internal.Duration{Duration: 5 * time.Minute},
+			HealthMaxBufferFill:  0.9,
+		},
 		InputFilters:  make(map[string]interface{}, 0),
 		OutputFilters: make(map[string]interface{}, 0),
 		Tags:          make(map[string]string),
 		Inputs:        make([]*models.RunningInput, 0),
 		Outputs:       make([]*models.RunningOutput, 0),
+		Processors:    make([]*models.RunningProcessor, 0),
+		Aggregators:   make([]*models.RunningAggregator, 0),
+		SecretStores:  make(map[string]asgard.SecretStore),
 	}
 	return c
 }
 
-// Check the occurrence of the name in list array
-func sliceContains(name string, list []interface{}) bool {
-	for _, b := range list {
-		if b == name {
-			return true
+// pluginNames returns the plugin names listed under key in one of the legacy
+// [InputFilters] / [OutputFilters] sections.
+func pluginNames(section map[string]interface{}, key string) ([]string, error) {
+	value, ok := section[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of plugin names", key)
+	}
+	names := make([]string, 0, len(list))
+	for _, v := range list {
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of plugin names, got %v", key, v)
 		}
+		names = append(names, name)
 	}
-	return false
+	return names, nil
 }
 
-// AddInput ...
-func (c *Config) AddInput(name string) error {
-	if len(c.InputFilters["inputs"].([]interface{})) > 0 && !sliceContains(name, c.InputFilters["inputs"].([]interface{})) {
+// sortedKeys returns the plugin names of a set of plugin tables in a stable
+// order, so plugins are always created in the same order.
+func sortedKeys(tables map[string][]toml.Primitive) []string {
+	keys := make([]string, 0, len(tables))
+	for k := range tables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pluginTable is one [[inputs.<name>]] or [[outputs.<name>]] table together
+// with the metadata of the file it comes from.
+type pluginTable struct {
+	md    *toml.MetaData
+	table toml.Primitive
+
+	// raw holds the same table decoded as plain values, see checksum
+	raw map[string]interface{}
+}
+
+// decode decodes the table into v. A nil table leaves v untouched, which
+// keeps the defaults of plugins that have no table. Secret references are
+// only resolved in secrets.Secret settings, a reference decoded into any
+// other setting is an error rather than a literal value sent to a server.
+func (t *pluginTable) decode(v interface{}) error {
+	if t == nil {
 		return nil
 	}
-	// Legacy support renaming io input to diskio
-	if name == "io" {
-		name = "diskio"
+	if err := t.md.PrimitiveDecode(t.table, v); err != nil {
+		return err
+	}
+	if names := secretRefSettings(reflect.ValueOf(v), ""); len(names) > 0 {
+		sort.Strings(names)
+		return fmt.Errorf("%s can't reference a secret, only credential settings can",
+			strings.Join(names, ", "))
+	}
+	return nil
+}
+
+var secretType = reflect.TypeOf(secrets.Secret{})
+
+// secretRefSettings returns the names of the settings of a decoded value
+// that hold a secret reference, other than secrets.Secret settings
+func secretRefSettings(v reflect.Value, name string) []string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return secretRefSettings(v.Elem(), name)
+	case reflect.String:
+		if len(secrets.Refs(v.String())) > 0 {
+			return []string{name}
+		}
+	case reflect.Slice, reflect.Array:
+		var names []string
+		for i := 0; i < v.Len(); i++ {
+			names = append(names, secretRefSettings(v.Index(i), name)...)
+		}
+		return dedup(names)
+	case reflect.Map:
+		var names []string
+		for _, k := range v.MapKeys() {
+			names = append(names, secretRefSettings(v.MapIndex(k), name)...)
+		}
+		return dedup(names)
+	case reflect.Struct:
+		if v.Type() == secretType {
+			return nil
+		}
+		var names []string
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := strings.Split(field.Tag.Get("toml"), ",")[0]
+			if field.PkgPath != "" || key == "-" {
+				continue
+			}
+			if key == "" {
+				key = field.Name
+			}
+			if field.Anonymous {
+				key = name
+			} else if name != "" {
+				key = name + "." + key
+			}
+			names = append(names, secretRefSettings(v.Field(i), key)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// dedup removes the repeated names of a setting
+func dedup(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
 	}
+	return out
+}
+
+// checksum identifies the settings a plugin is created from: the plugin name,
+// its table and any extra agent setting the plugin depends on. Plugins with
+// the same checksum are interchangeable when the config is reloaded.
+func checksum(name string, t *pluginTable, extra ...interface{}) string {
+	var raw map[string]interface{}
+	if t != nil {
+		raw = t.raw
+	}
+	// encoding/json sorts map keys, so equal tables give equal checksums
+	b, err := json.Marshal([]interface{}{name, raw, extra})
+	if err != nil {
+		b = []byte(fmt.Sprint(name, raw, extra))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildFilter builds and compiles the metric filter of a plugin table
+func buildFilter(t *pluginTable) (models.Filter, error) {
+	f := models.Filter{}
+
+	var ft filterTable
+	if err := t.decode(&ft); err != nil {
+		return f, err
+	}
+	f.NamePass = ft.NamePass
+	f.NameDrop = ft.NameDrop
+	f.FieldPass = ft.FieldPass
+	f.FieldDrop = ft.FieldDrop
+	f.TagInclude = ft.TagInclude
+	f.TagExclude = ft.TagExclude
+	f.TagPass = buildTagFilters(ft.TagPass)
+	f.TagDrop = buildTagFilters(ft.TagDrop)
+
+	if err := f.Compile(); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// buildProcessorFilter builds and compiles the filter selecting the metrics
+// a processor is applied to
+func buildProcessorFilter(t *pluginTable) (models.Filter, error) {
+	f := models.Filter{}
+
+	var ft processorFilterTable
+	if err := t.decode(&ft); err != nil {
+		return f, err
+	}
+	f.NamePass = ft.NamePass
+	f.NameDrop = ft.NameDrop
+	f.TagPass = buildTagFilters(ft.TagPass)
+	f.TagDrop = buildTagFilters(ft.TagDrop)
+
+	if err := f.Compile(); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// buildTagFilters converts a tagpass/tagdrop table into tag filters sorted by
+// tag name. It returns nil for an empty table, which disables the filter.
+func buildTagFilters(tables map[string][]string) []models.TagFilter {
+	if len(tables) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tagFilters := make([]models.TagFilter, 0, len(names))
+	for _, name := range names {
+		tagFilters = append(tagFilters, models.TagFilter{Name: name, Filter: tables[name]})
+	}
+	return tagFilters
+}
+
+// AddInput adds the named input with its default settings
+func (c *Config) AddInput(name string) error {
+	return c.addInput(name, nil)
+}
+
+// addInput creates the named input and, if a table is given, decodes the
+// [[inputs.<name>]] table into the plugin struct.
+func (c *Config) addInput(name string, table *pluginTable) error {
+	// Legacy support renaming io input to diskio
+	name = inputName(name)
 
 	creator, ok := inputs.Inputs[name]
 	if !ok {
@@ -142,36 +536,252 @@ func (c *Config) AddInput(name string) error {
 	}
 	input := creator()
 
-	rp := models.NewRunningInput(input)
+	var it inputTable
+	if err := table.decode(&it); err != nil {
+		return fmt.Errorf("Error parsing [[inputs.%s]]: %s", name, err)
+	}
+	if err := table.decode(input); err != nil {
+		return fmt.Errorf("Error parsing [[inputs.%s]]: %s", name, err)
+	}
+	pc := &models.InputConfig{
+		Name:              name,
+		Alias:             it.Alias,
+		NameOverride:      it.NameOverride,
+		MeasurementPrefix: it.NamePrefix,
+		MeasurementSuffix: it.NameSuffix,
+		Tags:              it.Tags,
+		Interval:          it.Interval.Duration,
+		Timeout:           it.Timeout.Duration,
+	}
+	if pc.Alias == "" {
+		for _, ri := range c.Inputs {
+			if ri.Config.Name == name && ri.Config.Alias == "" {
+				pc.Instance++
+			}
+		}
+	}
+	// the instance number tags the stats of the input, so the input is kept
+	// running on reload only with the same number
+	pc.Checksum = checksum(name, table, pc.Instance)
+
+	filter, err := buildFilter(table)
+	if err != nil {
+		return fmt.Errorf("Error parsing [[inputs.%s]]: %s", name, err)
+	}
+	pc.Filter = filter
+
+	for _, ri := range c.Inputs {
+		if pc.Alias != "" && ri.Config.Name == name && ri.Config.Alias == pc.Alias {
+			return fmt.Errorf("Duplicate alias %q for input %s", pc.Alias, name)
+		}
+	}
+
+	rp := models.NewRunningInput(input, pc)
+	if err := initPlugin(input); err != nil {
+		rp.UnregisterStats()
+		return fmt.Errorf("Error initializing [[inputs.%s]]: %s", name, err)
+	}
 	c.Inputs = append(c.Inputs, rp)
 	return nil
 }
 
-// AddOutput ...
-func (c *Config) AddOutput(name string) error {
-	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters["outputs"].([]interface{})) {
-		return nil
+// initPlugin calls Init on plugins and serializers that implement
+// asgard.Initializer
+func initPlugin(plugin interface{}) error {
+	if i, ok := plugin.(asgard.Initializer); ok {
+		return i.Init()
 	}
+	return nil
+}
+
+// AddOutput adds the named output with its default settings
+func (c *Config) AddOutput(name string) error {
+	return c.addOutput(name, nil)
+}
+
+// addOutput creates the named output and, if a table is given, decodes the
+// [[outputs.<name>]] table into the plugin struct.
+func (c *Config) addOutput(name string, table *pluginTable) error {
 	creator, ok := outputs.Outputs[name]
 	if !ok {
 		return fmt.Errorf("Undefined but requested output: %s", name)
 	}
 	output := creator()
 
+	var ot outputTable
+	if err := table.decode(&ot); err != nil {
+		return fmt.Errorf("Error parsing [[outputs.%s]]: %s", name, err)
+	}
+	if err := table.decode(output); err != nil {
+		return fmt.Errorf("Error parsing [[outputs.%s]]: %s", name, err)
+	}
+	oc := &models.OutputConfig{
+		Name:  name,
+		Alias: ot.Alias,
+	}
+	if oc.Alias == "" {
+		for _, ro := range c.Outputs {
+			if ro.Config.Name == name && ro.Config.Alias == "" {
+				oc.Instance++
+			}
+		}
+	}
+	// the buffers of an output are sized by the agent settings
+	oc.Checksum = checksum(name, table, oc.Instance, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+
+	filter, err := buildFilter(table)
+	if err != nil {
+		return fmt.Errorf("Error parsing [[outputs.%s]]: %s", name, err)
+	}
+	oc.Filter = filter
+
+	for _, ro := range c.Outputs {
+		if oc.Alias != "" && ro.Config.Name == name && ro.Config.Alias == oc.Alias {
+			return fmt.Errorf("Duplicate alias %q for output %s", oc.Alias, name)
+		}
+	}
+
 	switch t := output.(type) {
 	case serializers.SerializerOutput:
-		serializer, err := buildSerializer("json")
+		var sc serializerTable
+		if err := table.decode(&sc); err != nil {
+			return fmt.Errorf("Error parsing [[outputs.%s]]: %s", name, err)
+		}
+		serializer, err := buildSerializer(sc.DataFormat)
 		if err != nil {
-			return err
+			return fmt.Errorf("Error parsing [[outputs.%s]]: %s", name, err)
 		}
 		t.SetSerializer(serializer)
 	}
 
-	ro := models.NewRunningOutput(name, output, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	ro := models.NewRunningOutput(name, output, oc, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	if err := initPlugin(output); err != nil {
+		ro.UnregisterStats()
+		return fmt.Errorf("Error initializing [[outputs.%s]]: %s", name, err)
+	}
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
 
+// addProcessor creates the named processor and decodes the
+// [[processors.<name>]] table into the plugin struct. Processors are sorted
+// once every table was added, see sortProcessors.
+func (c *Config) addProcessor(name string, table *pluginTable) error {
+	creator, ok := processors.Processors[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested processor: %s", name)
+	}
+	processor := creator()
+
+	var pt processorTable
+	if err := table.decode(&pt); err != nil {
+		return fmt.Errorf("Error parsing [[processors.%s]]: %s", name, err)
+	}
+	if err := table.decode(processor); err != nil {
+		return fmt.Errorf("Error parsing [[processors.%s]]: %s", name, err)
+	}
+	pc := &models.ProcessorConfig{
+		Name:     name,
+		Alias:    pt.Alias,
+		Order:    pt.Order,
+		Checksum: checksum(name, table),
+	}
+
+	filter, err := buildProcessorFilter(table)
+	if err != nil {
+		return fmt.Errorf("Error parsing [[processors.%s]]: %s", name, err)
+	}
+	pc.Filter = filter
+
+	for _, rp := range c.Processors {
+		if pc.Alias != "" && rp.Config.Name == name && rp.Config.Alias == pc.Alias {
+			return fmt.Errorf("Duplicate alias %q for processor %s", pc.Alias, name)
+		}
+	}
+
+	rp := models.NewRunningProcessor(processor, pc)
+	if err := initPlugin(processor); err != nil {
+		return fmt.Errorf("Error initializing [[processors.%s]]: %s", name, err)
+	}
+	c.Processors = append(c.Processors, rp)
+	return nil
+}
+
+// sortProcessors sorts the processors by their order setting, processors of
+// the same order keep the order of their tables
+func (c *Config) sortProcessors() {
+	sort.SliceStable(c.Processors, func(i, j int) bool {
+		return c.Processors[i].Config.Order < c.Processors[j].Config.Order
+	})
+}
+
+// addAggregator creates the named aggregator and decodes the
+// [[aggregators.<name>]] table into the plugin struct.
+func (c *Config) addAggregator(name string, table *pluginTable) error {
+	creator, ok := aggregators.Aggregators[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested aggregator: %s", name)
+	}
+	aggregator := creator()
+
+	at := aggregatorTable{
+		Period: internal.Duration{Duration: 30 * time.Second},
+		Delay:  internal.Duration{Duration: 100 * time.Millisecond},
+	}
+	if err := table.decode(&at); err != nil {
+		return fmt.Errorf("Error parsing [[aggregators.%s]]: %s", name, err)
+	}
+	if err := table.decode(aggregator); err != nil {
+		return fmt.Errorf("Error parsing [[aggregators.%s]]: %s", name, err)
+	}
+	if at.Period.Duration <= 0 {
+		return fmt.Errorf("Error parsing [[aggregators.%s]]: period must be positive", name)
+	}
+	if at.Delay.Duration < 0 || at.Grace.Duration < 0 {
+		return fmt.Errorf("Error parsing [[aggregators.%s]]: delay and grace can't be negative", name)
+	}
+	ac := &models.AggregatorConfig{
+		Name:              name,
+		Alias:             at.Alias,
+		DropOriginal:      at.DropOriginal,
+		Period:            at.Period.Duration,
+		Delay:             at.Delay.Duration,
+		Grace:             at.Grace.Duration,
+		NameOverride:      at.NameOverride,
+		MeasurementPrefix: at.NamePrefix,
+		MeasurementSuffix: at.NameSuffix,
+		Tags:              at.Tags,
+	}
+	if ac.Alias == "" {
+		for _, ra := range c.Aggregators {
+			if ra.Config.Name == name && ra.Config.Alias == "" {
+				ac.Instance++
+			}
+		}
+	}
+	ac.Checksum = checksum(name, table, ac.Instance)
+
+	filter, err := buildFilter(table)
+	if err != nil {
+		return fmt.Errorf("Error parsing [[aggregators.%s]]: %s", name, err)
+	}
+	ac.Filter = filter
+
+	for _, ra := range c.Aggregators {
+		if ac.Alias != "" && ra.Config.Name == name && ra.Config.Alias == ac.Alias {
+			return fmt.Errorf("Duplicate alias %q for aggregator %s", ac.Alias, name)
+		}
+	}
+
+	ra := models.NewRunningAggregator(aggregator, ac)
+	if err := initPlugin(aggregator); err != nil {
+		ra.UnregisterStats()
+		return fmt.Errorf("Error initializing [[aggregators.%s]]: %s", name, err)
+	}
+	c.Aggregators = append(c.Aggregators, ra)
+	return nil
+}
+
 func buildSerializer(dataFormat string) (serializers.Serializer, error) {
 	c := &serializers.Config{TimestampUnits: time.Duration(10 * time.Second)}
 
@@ -180,15 +790,781 @@ func buildSerializer(dataFormat string) (serializers.Serializer, error) {
 		c.DataFormat = "json"
 	}
 
-	return serializers.NewSerializer(c)
+	serializer, err := serializers.NewSerializer(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := initPlugin(serializer); err != nil {
+		return nil, fmt.Errorf("Error initializing %s serializer: %s", c.DataFormat, err)
+	}
+	return serializer, nil
+}
+
+// interpolate expands the ${VAR}, ${VAR:-default} and @file:/path references
+// in the contents of a config file. ${VAR} fails when VAR is not set, while
+// ${VAR:-default} falls back to default when VAR is unset or empty.
+// @file:/path is replaced by the contents of the file without the trailing
+// newline, which keeps secrets such as passwords out of the config file.
+// $${ is written as a literal ${.
+//
+// The contents are expanded in a single pass, values are not expanded again,
+// and comments are left untouched. Values are escaped for the string they
+// are placed in, outside of strings only numbers, booleans and dates are
+// accepted.
+func interpolate(path string, contents []byte) ([]byte, error) {
+	var errs []string
+	out := make([]byte, 0, len(contents))
+	line := 1
+	context := tomlBare
+	for i := 0; i < len(contents); {
+		rest := contents[i:]
+		if bytes.HasPrefix(rest, []byte("$${")) {
+			out = append(out, "${"...)
+			i += 3
+			continue
+		}
+		if rest[0] == '$' || rest[0] == '@' {
+			value, n, err := expandRef(rest, context)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s:%d: %s", path, line, err))
+			}
+			if n > 0 {
+				out = append(out, value...)
+				i += n
+				continue
+			}
+		}
+
+		var n int
+		context, n = scanTOML(rest, context)
+		line += bytes.Count(rest[:n], []byte("\n"))
+		out = append(out, rest[:n]...)
+		i += n
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Error interpolating config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return out, nil
+}
+
+// TOML contexts a reference may appear in
+const (
+	tomlBare = iota
+	tomlBasic
+	tomlMultiBasic
+	tomlLiteral
+	tomlMultiLiteral
+)
+
+// scanTOML returns the context following the token at the start of b and
+// the length of the token: a comment, a quote, an escape sequence or a
+// single byte
+func scanTOML(b []byte, context int) (int, int) {
+	switch context {
+	case tomlBare:
+		switch {
+		case b[0] == '#':
+			if n := bytes.IndexByte(b, '\n'); n != -1 {
+				return context, n
+			}
+			return context, len(b)
+		case bytes.HasPrefix(b, []byte(`"""`)):
+			return tomlMultiBasic, 3
+		case bytes.HasPrefix(b, []byte(`'''`)):
+			return tomlMultiLiteral, 3
+		case b[0] == '"':
+			return tomlBasic, 1
+		case b[0] == '\'':
+			return tomlLiteral, 1
+		}
+	case tomlBasic, tomlMultiBasic:
+		switch {
+		case b[0] == '\\' && len(b) > 1:
+			return context, 2
+		case b[0] == '"' && context == tomlBasic:
+			return tomlBare, 1
+		case bytes.HasPrefix(b, []byte(`"""`)):
+			// up to two quotes may end the string before the delimiter
+			return tomlBare, countPrefix(b, '"', 5)
+		case b[0] == '\n' && context == tomlBasic:
+			return tomlBare, 1
+		}
+	case tomlLiteral:
+		if b[0] == '\'' || b[0] == '\n' {
+			return tomlBare, 1
+		}
+	case tomlMultiLiteral:
+		if bytes.HasPrefix(b, []byte(`'''`)) {
+			return tomlBare, countPrefix(b, '\'', 5)
+		}
+	}
+	return context, 1
 }
 
-// LoadConfig ...
-func (c *Config) LoadConfig() error {
-	flag.Parse()
-	_, err := toml.DecodeFile(utils.GetEnv("envConfigPath", flag.Arg(0)), c)
+// countPrefix returns how many times, up to max, b starts with c
+func countPrefix(b []byte, c byte, max int) int {
+	n := 0
+	for n < len(b) && n < max && b[n] == c {
+		n++
+	}
+	return n
+}
+
+// expandRef expands the reference at the start of ref for the given context.
+// It returns the expanded value and the length of the reference, which is 0
+// when ref doesn't start with a reference.
+func expandRef(ref []byte, context int) ([]byte, int, error) {
+	if m := envVarRe.FindSubmatch(ref); m != nil {
+		value, ok := os.LookupEnv(string(m[1]))
+		if len(m[2]) > 0 && value == "" {
+			// the default is written in the config file, it is already
+			// valid where it appears
+			return m[3], len(m[0]), nil
+		}
+		if !ok {
+			return m[0], len(m[0]), fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		quoted, err := quoteValue(value, context)
+		if err != nil {
+			return m[0], len(m[0]), fmt.Errorf("environment variable %s %s", m[1], err)
+		}
+		return quoted, len(m[0]), nil
+	}
+
+	if m := fileRe.FindSubmatch(ref); m != nil {
+		value, err := ioutil.ReadFile(string(m[1]))
+		if err != nil {
+			return m[0], len(m[0]), err
+		}
+		quoted, err := quoteValue(string(bytes.TrimRight(value, "\r\n")), context)
+		if err != nil {
+			return m[0], len(m[0]), fmt.Errorf("file %s %s", m[1], err)
+		}
+		return quoted, len(m[0]), nil
+	}
+	return nil, 0, nil
+}
+
+// quoteValue returns value written for the given context. Basic strings are
+// escaped, literal strings have no escapes so values that can't be written in
+// them are rejected, like values that aren't a number, a boolean or a date
+// outside of strings.
+func quoteValue(value string, context int) ([]byte, error) {
+	switch context {
+	case tomlBasic, tomlMultiBasic:
+		return escapeBasic(value), nil
+	case tomlLiteral:
+		if strings.ContainsRune(value, '\'') || hasControl(value, "\t") {
+			return nil, fmt.Errorf("contains a quote or a control character, it can't be used in a 'literal' string")
+		}
+	case tomlMultiLiteral:
+		if strings.Contains(value, "'''") || hasControl(value, "\t\r\n") {
+			return nil, fmt.Errorf("contains ''' or a control character, it can't be used in a '''literal''' string")
+		}
+	default:
+		if !bareValueRe.MatchString(value) {
+			return nil, fmt.Errorf("is not a number, a boolean or a date, it must be used inside a string")
+		}
+	}
+	return []byte(value), nil
+}
+
+// escapeBasic escapes s for a TOML basic string
+func escapeBasic(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch r {
+		case '"':
+			b = append(b, `\"`...)
+		case '\\':
+			b = append(b, `\\`...)
+		case '\b':
+			b = append(b, `\b`...)
+		case '\t':
+			b = append(b, `\t`...)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\f':
+			b = append(b, `\f`...)
+		case '\r':
+			b = append(b, `\r`...)
+		default:
+			if r < 0x20 || r == 0x7f {
+				b = append(b, fmt.Sprintf(`\u%04X`, r)...)
+				continue
+			}
+			b = append(b, string(r)...)
+		}
+	}
+	return b
+}
+
+// hasControl reports whether s contains a control character other than the
+// allowed ones
+func hasControl(s, allowed string) bool {
+	for _, r := range s {
+		if (r < 0x20 || r == 0x7f) && !strings.ContainsRune(allowed, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// configFile is a parsed config file. Its plugin tables can only be decoded
+// with the metadata of the file they come from.
+type configFile struct {
+	path string
+	md   toml.MetaData
+	toml *tomlConfig
+	raw  *rawConfig
+}
+
+// rawConfig holds the plugin tables of a config file as plain values. It is
+// decoded separately, so it doesn't hide unknown keys from the metadata of
+// the file.
+type rawConfig struct {
+	Inputs      map[string][]map[string]interface{} `toml:"inputs"`
+	Outputs     map[string][]map[string]interface{} `toml:"outputs"`
+	Processors  map[string][]map[string]interface{} `toml:"processors"`
+	Aggregators map[string][]map[string]interface{} `toml:"aggregators"`
+}
+
+// input returns the i-th [[inputs.<name>]] table of the file
+func (f *configFile) input(name string, i int) *pluginTable {
+	return &pluginTable{md: &f.md, table: f.toml.Inputs[name][i], raw: f.raw.Inputs[name][i]}
+}
+
+// output returns the i-th [[outputs.<name>]] table of the file
+func (f *configFile) output(name string, i int) *pluginTable {
+	return &pluginTable{md: &f.md, table: f.toml.Outputs[name][i], raw: f.raw.Outputs[name][i]}
+}
+
+// aggregator returns the i-th [[aggregators.<name>]] table of the file
+func (f *configFile) aggregator(name string, i int) *pluginTable {
+	return &pluginTable{md: &f.md, table: f.toml.Aggregators[name][i], raw: f.raw.Aggregators[name][i]}
+}
+
+// processorTables returns the [[processors.<name>]] tables of the file in the
+// order they appear in
+func (f *configFile) processorTables() []processorRef {
+	var refs []processorRef
+	seen := make(map[string]int)
+	for _, key := range f.md.Keys() {
+		if len(key) != 2 || key[0] != "processors" {
+			continue
+		}
+		name := key[1]
+		if seen[name] >= len(f.toml.Processors[name]) {
+			continue
+		}
+		i := seen[name]
+		seen[name]++
+		refs = append(refs, processorRef{
+			name:  name,
+			table: &pluginTable{md: &f.md, table: f.toml.Processors[name][i], raw: f.raw.Processors[name][i]},
+		})
+	}
+	return refs
+}
+
+// processorRef is a [[processors.<name>]] table of a config file
+type processorRef struct {
+	name  string
+	table *pluginTable
+}
+
+// LoadConfig loads the config file at path and, when dir is not empty, every
+// *.toml file in dir in sorted order, then creates every configured plugin.
+// When path is empty the DEFAULT_CONFIG environment variable is used.
+//
+// Settings of [Agent] and [Tags] may be spread over several files but each of
+// them may only be set once. Plugin tables and the [InputFilters] /
+// [OutputFilters] lists of all files are merged.
+//
+// Unknown plugins, unknown settings and settings that fail to decode, such
+// as invalid durations, are all reported in the returned error.
+func (c *Config) LoadConfig(path, dir string) error {
+	paths, err := configPaths(path, dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("No config file given")
+	}
+
+	owners := make(map[string]string)
+	files := make([]*configFile, 0, len(paths))
+	for _, p := range paths {
+		f, err := c.parseFile(p, owners)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	return c.addFiles(files)
+}
+
+// LoadRemoteConfig loads the config last fetched by r, followed by the *.toml
+// files of dir like LoadConfig does. The fetched config is only interpolated
+// when r.Interpolate is set. A config that loads is cached by r as the last
+// known good one.
+func (c *Config) LoadRemoteConfig(r *Remote, dir string) error {
+	paths, err := dirPaths(dir)
+	if err != nil {
+		return err
+	}
+
+	contents := r.Contents()
+	decoded := contents
+	if r.Interpolate {
+		decoded, err = interpolate(r.URL, contents)
+		if err != nil {
+			return err
+		}
+	}
+	owners := make(map[string]string)
+	f, err := c.parse(r.URL, decoded, owners)
+	if err != nil {
+		return err
+	}
+	files := []*configFile{f}
+	for _, p := range paths {
+		f, err := c.parseFile(p, owners)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	if err := c.addFiles(files); err != nil {
+		return err
+	}
+	r.loaded(contents)
+	return nil
+}
+
+// UnregisterStats unregisters the stats of the inputs, outputs and
+// aggregators of a config that is discarded
+func (c *Config) UnregisterStats() {
+	for _, input := range c.Inputs {
+		input.UnregisterStats()
+	}
+	for _, output := range c.Outputs {
+		output.UnregisterStats()
+	}
+	for _, agg := range c.Aggregators {
+		agg.UnregisterStats()
+	}
+}
+
+// addFiles creates the plugins of the parsed config files
+func (c *Config) addFiles(files []*configFile) error {
+	errs := c.addPlugins(files)
+	switch c.Agent.LogFormat {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Sprintf("invalid log_format %q, must be text or json", c.Agent.LogFormat))
+	}
+	if c.Agent.HealthMaxBufferFill < 0 || c.Agent.HealthMaxBufferFill > 1 {
+		errs = append(errs, fmt.Sprintf("invalid health_max_buffer_fill %v, must be between 0 and 1", c.Agent.HealthMaxBufferFill))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// configPaths returns the config files to load: the file at path, or the one
+// named by DEFAULT_CONFIG when path is empty, followed by the *.toml files of
+// dir in sorted order.
+func configPaths(path, dir string) ([]string, error) {
+	if path == "" {
+		path = utils.GetEnv(envConfigPath, "")
+	}
+
+	var paths []string
+	if path != "" {
+		paths = append(paths, path)
+	}
+	matches, err := dirPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(paths, matches...), nil
+}
+
+// dirPaths returns the *.toml files of dir in sorted order
+func dirPaths(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// parseFile decodes a config file and merges its agent settings, tags and
+// plugin lists into c. owners records which file set each [Agent] and [Tags]
+// key, so conflicting settings can be reported with both file names.
+// Environment variable and file references are expanded before decoding, see
+// interpolate.
+func (c *Config) parseFile(path string, owners map[string]string) (*configFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	contents, err = interpolate(path, contents)
+	if err != nil {
+		return nil, err
+	}
+	return c.parse(path, contents, owners)
+}
+
+// parse is parseFile for the interpolated contents read from path
+func (c *Config) parse(path string, contents []byte, owners map[string]string) (*configFile, error) {
+	tc := &tomlConfig{
+		Agent:         c.Agent,
+		Tags:          make(map[string]string),
+		InputFilters:  make(map[string]interface{}),
+		OutputFilters: make(map[string]interface{}),
+	}
+	md, err := toml.Decode(string(contents), tc)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err)
+	}
+	raw := &rawConfig{}
+	if _, err := toml.Decode(string(contents), raw); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err)
+	}
+
+	for _, key := range md.Keys() {
+		if len(key) != 2 {
+			continue
+		}
+		section := strings.ToLower(key[0])
+		if section != "agent" && section != "tags" {
+			continue
+		}
+		if section == "agent" && durationKeys[strings.ToLower(key[1])] && md.Type(key...) != "String" {
+			return nil, fmt.Errorf("Error parsing %s: %s must be a duration string such as \"10s\", not a number", path, key)
+		}
+		name := section + "." + key[1]
+		if owner, ok := owners[name]; ok {
+			return nil, fmt.Errorf("Conflicting setting %s: set in both %s and %s", key, owner, path)
+		}
+		owners[name] = path
+	}
+
+	for k, v := range tc.Tags {
+		c.Tags[k] = v
+	}
+	if err := mergeNames(c.InputFilters, tc.InputFilters, "inputs"); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err)
+	}
+	if err := mergeNames(c.OutputFilters, tc.OutputFilters, "outputs"); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", path, err)
+	}
+
+	return &configFile{path: path, md: md, toml: tc, raw: raw}, nil
+}
+
+// mergeNames appends the plugin names listed under key in src to the list in
+// dst, skipping names that are already listed.
+func mergeNames(dst, src map[string]interface{}, key string) error {
+	names, err := pluginNames(src, key)
 	if err != nil {
 		return err
 	}
+	if names == nil {
+		return nil
+	}
+
+	list, _ := dst[key].([]interface{})
+	for _, name := range names {
+		if !sliceContains(name, list) {
+			list = append(list, name)
+		}
+	}
+	dst[key] = list
 	return nil
 }
+
+// Check the occurrence of the name in list array
+func sliceContains(name string, list []interface{}) bool {
+	for _, b := range list {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addPlugins creates the plugins of every config file. Plugins are configured
+// by [[inputs.<name>]], [[outputs.<name>]], [[processors.<name>]] and
+// [[aggregators.<name>]] tables; inputs and outputs that are only listed in
+// [InputFilters] / [OutputFilters] are created with their default settings. It keeps going after a broken
+// plugin, so every problem of the config is returned at once.
+func (c *Config) addPlugins(files []*configFile) []string {
+	var errs []string
+
+	// Secret stores are created first, plugin settings are checked against
+	// them
+	for _, f := range files {
+		for _, name := range sortedKeys(f.toml.SecretStores) {
+			for _, table := range f.toml.SecretStores[name] {
+				if err := c.addSecretStore(name, &pluginTable{md: &f.md, table: table}); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", f.path, err))
+				}
+			}
+		}
+	}
+	for _, f := range files {
+		errs = append(errs, c.unknownSecretStores(f)...)
+	}
+
+	// Outputs are created first so the buffer settings of [Agent] apply to them
+	tables := make(map[string]bool)
+	for _, f := range files {
+		for _, name := range sortedKeys(f.toml.Outputs) {
+			if !c.outputSelected(name) {
+				continue
+			}
+			tables[name] = true
+			for i := range f.toml.Outputs[name] {
+				if err := c.addOutput(name, f.output(name, i)); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", f.path, err))
+				}
+			}
+		}
+	}
+	// the lists have already been checked by mergeNames
+	names, _ := pluginNames(c.OutputFilters, "outputs")
+	if len(c.SelectedOutputs) > 0 {
+		names = c.SelectedOutputs
+	}
+	for _, name := range names {
+		if tables[name] {
+			continue
+		}
+		if err := c.AddOutput(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	tables = make(map[string]bool)
+	for _, f := range files {
+		for _, name := range sortedKeys(f.toml.Inputs) {
+			if !c.inputSelected(name) {
+				continue
+			}
+			tables[inputName(name)] = true
+			for i := range f.toml.Inputs[name] {
+				if err := c.addInput(name, f.input(name, i)); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", f.path, err))
+				}
+			}
+		}
+	}
+	names, _ = pluginNames(c.InputFilters, "inputs")
+	if len(c.SelectedInputs) > 0 {
+		names = c.SelectedInputs
+	}
+	for _, name := range names {
+		if tables[inputName(name)] {
+			continue
+		}
+		if err := c.AddInput(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	// Processors run in the order of their tables, across files in the
+	// order the files are loaded
+	for _, f := range files {
+		for _, ref := range f.processorTables() {
+			if err := c.addProcessor(ref.name, ref.table); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", f.path, err))
+			}
+		}
+	}
+	c.sortProcessors()
+
+	for _, f := range files {
+		for _, name := range sortedKeys(f.toml.Aggregators) {
+			for i := range f.toml.Aggregators[name] {
+				if err := c.addAggregator(name, f.aggregator(name, i)); err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", f.path, err))
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		errs = append(errs, c.undecodedKeys(f)...)
+	}
+	return errs
+}
+
+// addSecretStore creates a secret store from a [[secretstores.<name>]] table
+func (c *Config) addSecretStore(name string, table *pluginTable) error {
+	creator, ok := secretstores.SecretStores[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested secret store: %s", name)
+	}
+
+	var st secretStoreTable
+	if err := table.decode(&st); err != nil {
+		return fmt.Errorf("Error parsing [[secretstores.%s]]: %s", name, err)
+	}
+	if st.ID == "" {
+		return fmt.Errorf("Error parsing [[secretstores.%s]]: id is required", name)
+	}
+	if _, ok := c.SecretStores[st.ID]; ok {
+		return fmt.Errorf("Duplicate secret store id %q", st.ID)
+	}
+
+	store := creator()
+	if err := table.decode(store); err != nil {
+		return fmt.Errorf("Error parsing [[secretstores.%s]]: %s", name, err)
+	}
+	c.SecretStores[st.ID] = store
+	return nil
+}
+
+// unknownSecretStores reports the secret references of the plugin tables of
+// a config file that name a store which isn't configured.
+func (c *Config) unknownSecretStores(f *configFile) []string {
+	var errs []string
+	check := func(section, name string, table map[string]interface{}) {
+		walkStrings(table, func(s string) {
+			for _, ref := range secrets.Refs(s) {
+				if _, ok := c.SecretStores[ref.Store]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: [[%s.%s]] references unknown secret store %q",
+						f.path, section, name, ref.Store))
+				}
+			}
+		})
+	}
+	for name, tables := range f.raw.Inputs {
+		for _, table := range tables {
+			check("inputs", name, table)
+		}
+	}
+	for name, tables := range f.raw.Outputs {
+		for _, table := range tables {
+			check("outputs", name, table)
+		}
+	}
+	for name, tables := range f.raw.Processors {
+		for _, table := range tables {
+			check("processors", name, table)
+		}
+	}
+	for name, tables := range f.raw.Aggregators {
+		for _, table := range tables {
+			check("aggregators", name, table)
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// walkStrings calls fn for every string in a decoded TOML value
+func walkStrings(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case []interface{}:
+		for _, e := range v {
+			walkStrings(e, fn)
+		}
+	case []map[string]interface{}:
+		for _, e := range v {
+			walkStrings(e, fn)
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			walkStrings(e, fn)
+		}
+	}
+}
+
+// inputSelected reports whether the tables of the named input are loaded
+func (c *Config) inputSelected(name string) bool {
+	if len(c.SelectedInputs) == 0 {
+		return true
+	}
+	for _, s := range c.SelectedInputs {
+		if inputName(s) == inputName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// inputName returns the name the input is registered under, the io input has
+// been renamed to diskio.
+func inputName(name string) string {
+	if name == "io" {
+		return "diskio"
+	}
+	return name
+}
+
+// outputSelected reports whether the tables of the named output are loaded
+func (c *Config) outputSelected(name string) bool {
+	if len(c.SelectedOutputs) == 0 {
+		return true
+	}
+	for _, s := range c.SelectedOutputs {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// undecodedKeys reports every key of a config file that was not decoded into
+// the agent settings or one of its plugins, ie misspelled settings. Keys of
+// unknown plugins are skipped, the plugin itself is already reported, and so
+// are the keys of plugins left out by SelectedInputs / SelectedOutputs.
+func (c *Config) undecodedKeys(f *configFile) []string {
+	var errs []string
+	for _, key := range f.md.Undecoded() {
+		if len(key) > 1 {
+			switch key[0] {
+			case "inputs":
+				if _, ok := inputs.Inputs[key[1]]; !ok && key[1] != "io" {
+					continue
+				}
+				if !c.inputSelected(key[1]) {
+					continue
+				}
+			case "outputs":
+				if _, ok := outputs.Outputs[key[1]]; !ok {
+					continue
+				}
+				if !c.outputSelected(key[1]) {
+					continue
+				}
+			case "processors":
+				if _, ok := processors.Processors[key[1]]; !ok {
+					continue
+				}
+			case "aggregators":
+				if _, ok := aggregators.Aggregators[key[1]]; !ok {
+					continue
+				}
+			case "secretstores":
+				if _, ok := secretstores.SecretStores[key[1]]; !ok {
+					continue
+				}
+			}
+		}
+		errs = append(errs, fmt.Sprintf("%s: unknown setting %s", f.path, key))
+	}
+	return errs
+}
@@ -0,0 +1,1015 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/models"
+	"github.com/anabiozz/asgard/internal/secrets"
+	"github.com/anabiozz/asgard/plugins/inputs"
+	"github.com/anabiozz/asgard/plugins/outputs"
+	"github.com/anabiozz/asgard/plugins/secretstores"
+)
+
+// testInput and testOutput are registered for the config tests only
+type testInput struct {
+	Servers []string `toml:"servers"`
+	Port    int      `toml:"port"`
+}
+
+func (*testInput) SampleConfig() string                { return "" }
+func (*testInput) Description() string                 { return "" }
+func (*testInput) Gather(acc asgard.Accumulator) error { return nil }
+
+type testOutput struct {
+	URL      string         `toml:"url"`
+	Password secrets.Secret `toml:"password"`
+}
+
+func (*testOutput) Connect() error                      { return nil }
+func (*testOutput) Close() error                        { return nil }
+func (*testOutput) Write(metrics []asgard.Metric) error { return nil }
+func (*testOutput) Description() string                 { return "" }
+func (*testOutput) SampleConfig() string                { return "" }
+
+// testStore returns the key of a secret as its value
+type testStore struct{}
+
+func (testStore) SampleConfig() string           { return "" }
+func (testStore) Description() string            { return "" }
+func (testStore) Get(key string) ([]byte, error) { return []byte(key), nil }
+
+// initInput and initOutput fail to initialize when fail is set
+type initInput struct {
+	Fail        bool `toml:"fail"`
+	initialized bool
+}
+
+func (*initInput) SampleConfig() string                { return "" }
+func (*initInput) Description() string                 { return "" }
+func (*initInput) Gather(acc asgard.Accumulator) error { return nil }
+func (i *initInput) Init() error {
+	if i.Fail {
+		return errors.New("invalid settings")
+	}
+	i.initialized = true
+	return nil
+}
+
+type initOutput struct {
+	Fail bool `toml:"fail"`
+}
+
+func (*initOutput) Connect() error                      { return nil }
+func (*initOutput) Close() error                        { return nil }
+func (*initOutput) Write(metrics []asgard.Metric) error { return nil }
+func (*initOutput) Description() string                 { return "" }
+func (*initOutput) SampleConfig() string                { return "" }
+func (o *initOutput) Init() error {
+	if o.Fail {
+		return errors.New("invalid settings")
+	}
+	return nil
+}
+
+func init() {
+	inputs.Add("test", func() asgard.Input { return &testInput{Port: 8080} })
+	outputs.Add("test", func() asgard.Output { return &testOutput{} })
+	inputs.Add("other", func() asgard.Input { return &testInput{} })
+	inputs.Add("init", func() asgard.Input { return &initInput{} })
+	outputs.Add("init", func() asgard.Output { return &initOutput{} })
+	secretstores.Add("test", func() asgard.SecretStore { return testStore{} })
+}
+
+// loadConfig writes the config file and the files of the config directory,
+// by name, to a temporary directory and loads them
+func loadConfig(t *testing.T, contents string, dirFiles map[string]string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "asgard-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asgard.toml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var confDir string
+	if dirFiles != nil {
+		confDir = filepath.Join(dir, "conf.d")
+		if err := os.Mkdir(confDir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range dirFiles {
+			if err := ioutil.WriteFile(filepath.Join(confDir, name), []byte(contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	c := NewConfig()
+	return c, c.LoadConfig(path, confDir)
+}
+
+// inputSettings returns the settings decoded into the test inputs
+func inputSettings(c *Config) []testInput {
+	var settings []testInput
+	for _, ri := range c.Inputs {
+		if input, ok := ri.Input.(*testInput); ok {
+			settings = append(settings, *input)
+		}
+	}
+	return settings
+}
+
+func TestLoadPluginTables(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		inputs   []testInput
+		outputs  []string
+		err      string
+	}{
+		{
+			name: "tables",
+			contents: `
+[[inputs.test]]
+  servers = ["a", "b"]
+  port = 9090
+[[inputs.test]]
+[[outputs.test]]
+  url = "http://a"
+`,
+			inputs:  []testInput{{Servers: []string{"a", "b"}, Port: 9090}, {Port: 8080}},
+			outputs: []string{"http://a"},
+		},
+		{
+			name: "legacy lists",
+			contents: `
+[InputFilters]
+  inputs = ["test"]
+[OutputFilters]
+  outputs = ["test"]
+`,
+			inputs:  []testInput{{Port: 8080}},
+			outputs: []string{""},
+		},
+		{
+			name: "listed and configured",
+			contents: `
+[InputFilters]
+  inputs = ["test"]
+[[inputs.test]]
+  port = 1
+`,
+			inputs: []testInput{{Port: 1}},
+		},
+		{
+			name:     "unknown input",
+			contents: "[[inputs.missing]]\n",
+			err:      "Undefined but requested input: missing",
+		},
+		{
+			name:     "unknown output",
+			contents: "[OutputFilters]\n  outputs = [\"missing\"]\n",
+			err:      "Undefined but requested output: missing",
+		},
+		{
+			name:     "wrong type",
+			contents: "[[inputs.test]]\n  port = \"a\"\n",
+			err:      "Error parsing [[inputs.test]]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if settings := inputSettings(c); !reflect.DeepEqual(settings, tt.inputs) {
+				t.Errorf("expected inputs %+v, got %+v", tt.inputs, settings)
+			}
+			var urls []string
+			for _, ro := range c.Outputs {
+				urls = append(urls, ro.Output.(*testOutput).URL)
+			}
+			if !reflect.DeepEqual(urls, tt.outputs) {
+				t.Errorf("expected outputs %q, got %q", tt.outputs, urls)
+			}
+		})
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		names    []string
+		err      string
+	}{
+		{
+			name: "aliased instances",
+			contents: `
+[[inputs.test]]
+  alias = "a"
+[[inputs.test]]
+  alias = "b"
+[[inputs.test]]
+`,
+			names: []string{"inputs.test::a", "inputs.test::b", "inputs.test"},
+		},
+		{
+			name: "duplicate input alias",
+			contents: `
+[[inputs.test]]
+  alias = "a"
+[[inputs.test]]
+  alias = "a"
+`,
+			err: `Duplicate alias "a" for input test`,
+		},
+		{
+			name: "duplicate output alias",
+			contents: `
+[[outputs.test]]
+  alias = "a"
+[[outputs.test]]
+  alias = "a"
+`,
+			err: `Duplicate alias "a" for output test`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var names []string
+			for _, ri := range c.Inputs {
+				names = append(names, ri.Name())
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("expected %q, got %q", tt.names, names)
+			}
+		})
+	}
+}
+
+func TestLoadInstances(t *testing.T) {
+	c, err := loadConfig(t, `
+[[inputs.test]]
+[[inputs.test]]
+  alias = "a"
+[[inputs.test]]
+[[outputs.test]]
+  url = "a"
+[[outputs.test]]
+  url = "a"
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		config   interface{}
+		instance int
+	}{
+		{name: "first input", config: c.Inputs[0].Config, instance: 0},
+		{name: "aliased input", config: c.Inputs[1].Config, instance: 0},
+		{name: "second input", config: c.Inputs[2].Config, instance: 1},
+		{name: "first output", config: c.Outputs[0].Config, instance: 0},
+		{name: "second output", config: c.Outputs[1].Config, instance: 1},
+	}
+	for _, tt := range tests {
+		var instance int
+		switch config := tt.config.(type) {
+		case *models.InputConfig:
+			instance = config.Instance
+		case *models.OutputConfig:
+			instance = config.Instance
+		}
+		if instance != tt.instance {
+			t.Errorf("%s: expected instance %d, got %d", tt.name, tt.instance, instance)
+		}
+	}
+
+	// identical instances are told apart on reload
+	if c.Inputs[0].Config.Checksum == c.Inputs[2].Config.Checksum {
+		t.Error("expected different checksums for the unaliased inputs")
+	}
+	if c.Outputs[0].Config.Checksum == c.Outputs[1].Config.Checksum {
+		t.Error("expected different checksums for the outputs")
+	}
+}
+
+func TestLoadInputSettings(t *testing.T) {
+	c, err := loadConfig(t, `
+[[inputs.test]]
+  interval = "5s"
+  timeout = "2s"
+  name_override = "renamed"
+  name_prefix = "pre_"
+  name_suffix = "_suf"
+  [inputs.test.tags]
+    dc = "eu"
+[[inputs.test]]
+`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		timeout  time.Duration
+		metric   string
+		tags     map[string]string
+	}{
+		{
+			name:     "settings",
+			interval: 5 * time.Second,
+			timeout:  2 * time.Second,
+			metric:   "pre_renamed_suf",
+			tags:     map[string]string{"dc": "eu", "host": "a"},
+		},
+		{
+			name:   "defaults",
+			metric: "test",
+			tags:   map[string]string{"host": "a"},
+		},
+	}
+
+	if len(c.Inputs) != len(tests) {
+		t.Fatalf("expected %d inputs, got %d", len(tests), len(c.Inputs))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := c.Inputs[i].Config
+			if config.Interval != tt.interval || config.Timeout != tt.timeout {
+				t.Errorf("expected interval %s and timeout %s, got %s and %s",
+					tt.interval, tt.timeout, config.Interval, config.Timeout)
+			}
+			m := c.Inputs[i].MakeMetric("test", map[string]interface{}{"value": 1},
+				map[string]string{"host": "a"}, asgard.Untyped, time.Now())
+			if m.Name() != tt.metric {
+				t.Errorf("expected measurement %q, got %q", tt.metric, m.Name())
+			}
+			if tags := m.Tags(); !reflect.DeepEqual(tags, tt.tags) {
+				t.Errorf("expected tags %v, got %v", tt.tags, tags)
+			}
+		})
+	}
+}
+
+func TestLoadFilters(t *testing.T) {
+	c, err := loadConfig(t, `
+[[inputs.test]]
+  namepass = ["cpu*"]
+  fielddrop = ["usage_guest*"]
+  taginclude = ["cpu", "host"]
+  [inputs.test.tagpass]
+    cpu = ["cpu-total"]
+`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ri := c.Inputs[0]
+
+	tests := []struct {
+		name   string
+		metric string
+		tags   map[string]string
+		fields map[string]interface{}
+		pass   bool
+	}{
+		{
+			name:   "dropped by namepass",
+			metric: "mem",
+			tags:   map[string]string{"cpu": "cpu-total"},
+			pass:   false,
+		},
+		{
+			name:   "dropped by tagpass",
+			metric: "cpu",
+			tags:   map[string]string{"cpu": "cpu0"},
+			pass:   false,
+		},
+		{
+			name:   "filtered fields and tags",
+			metric: "cpu",
+			tags:   map[string]string{"cpu": "cpu-total", "host": "a", "dc": "eu"},
+			fields: map[string]interface{}{"usage_idle": 1.0},
+			pass:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ri.MakeMetric(tt.metric,
+				map[string]interface{}{"usage_idle": 1.0, "usage_guest": 2.0},
+				tt.tags, asgard.Untyped, time.Now())
+			if (m != nil) != tt.pass {
+				t.Fatalf("expected pass %v, got %v", tt.pass, m)
+			}
+			if m == nil {
+				return
+			}
+			if fields := m.Fields(); !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected fields %v, got %v", tt.fields, fields)
+			}
+			if tags := m.Tags(); !reflect.DeepEqual(tags, map[string]string{"cpu": "cpu-total", "host": "a"}) {
+				t.Errorf("expected the included tags, got %v", tags)
+			}
+		})
+	}
+
+	if _, err := loadConfig(t, "[[outputs.test]]\n  namepass = [\"[\"]\n", nil); err == nil ||
+		!strings.Contains(err.Error(), "Error compiling 'namepass'") {
+		t.Errorf("expected a namepass compile error, got %v", err)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("p\"ss\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "nested")
+	if err := ioutil.WriteFile(nested, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("ASGARD_TEST_USER", "admin")
+	os.Setenv("ASGARD_TEST_QUOTE", `a"b\c`)
+	os.Setenv("ASGARD_TEST_NEWLINE", "a\n[inputs.cpu]\r\x01")
+	os.Setenv("ASGARD_TEST_SINGLE", "it's")
+	os.Setenv("ASGARD_TEST_NUMBER", "1000")
+	os.Setenv("ASGARD_TEST_FILE", "@file:"+nested)
+	os.Setenv("ASGARD_TEST_EMPTY", "")
+	os.Unsetenv("ASGARD_TEST_UNSET")
+
+	tests := []struct {
+		name     string
+		contents string
+		expected string
+		err      string
+	}{
+		{
+			name:     "variable",
+			contents: `user = "${ASGARD_TEST_USER}"`,
+			expected: `user = "admin"`,
+		},
+		{
+			name:     "default",
+			contents: `user = "${ASGARD_TEST_EMPTY:-guest}" # ${ASGARD_TEST_UNSET}`,
+			expected: `user = "guest" # ${ASGARD_TEST_UNSET}`,
+		},
+		{
+			name:     "unset",
+			contents: "a = 1\nuser = \"${ASGARD_TEST_UNSET}\"",
+			err:      "test.toml:2: environment variable ASGARD_TEST_UNSET is not set",
+		},
+		{
+			name:     "escaped in basic string",
+			contents: `user = "${ASGARD_TEST_QUOTE}"`,
+			expected: `user = "a\"b\\c"`,
+		},
+		{
+			name:     "control characters in basic string",
+			contents: `user = "${ASGARD_TEST_NEWLINE}"`,
+			expected: `user = "a\n[inputs.cpu]\r\u0001"`,
+		},
+		{
+			name:     "multi-line basic string",
+			contents: "user = \"\"\"\n${ASGARD_TEST_QUOTE}\"\"\"",
+			expected: "user = \"\"\"\na\\\"b\\\\c\"\"\"",
+		},
+		{
+			name:     "literal string",
+			contents: `path = 'C:\${ASGARD_TEST_USER}'`,
+			expected: `path = 'C:\admin'`,
+		},
+		{
+			name:     "quote in literal string",
+			contents: `user = '${ASGARD_TEST_SINGLE}'`,
+			err:      "environment variable ASGARD_TEST_SINGLE contains a quote",
+		},
+		{
+			name:     "newline in literal string",
+			contents: `user = '${ASGARD_TEST_NEWLINE}'`,
+			err:      "environment variable ASGARD_TEST_NEWLINE contains a quote or a control character",
+		},
+		{
+			name:     "number outside of a string",
+			contents: `metric_batch_size = ${ASGARD_TEST_NUMBER}`,
+			expected: `metric_batch_size = 1000`,
+		},
+		{
+			name:     "string outside of a string",
+			contents: `metric_batch_size = ${ASGARD_TEST_NEWLINE}`,
+			err:      "must be used inside a string",
+		},
+		{
+			name:     "whole-line comment",
+			contents: "  # user = \"${ASGARD_TEST_UNSET}\"\nuser = \"${ASGARD_TEST_USER}\"",
+			expected: "  # user = \"${ASGARD_TEST_UNSET}\"\nuser = \"admin\"",
+		},
+		{
+			name:     "trailing comment",
+			contents: `user = "#${ASGARD_TEST_USER}" # "${ASGARD_TEST_UNSET}"`,
+			expected: `user = "#admin" # "${ASGARD_TEST_UNSET}"`,
+		},
+		{
+			name:     "escape",
+			contents: `name_templates = ["$${ID_FS_LABEL}", "$DM_VG_NAME"]`,
+			expected: `name_templates = ["${ID_FS_LABEL}", "$DM_VG_NAME"]`,
+		},
+		{
+			name:     "group reference",
+			contents: `replacement = "${1}"`,
+			expected: `replacement = "${1}"`,
+		},
+		{
+			name:     "file",
+			contents: `password = "@file:` + secret + `"`,
+			expected: `password = "p\"ss"`,
+		},
+		{
+			name:     "missing file",
+			contents: `password = "@file:` + filepath.Join(dir, "missing") + `"`,
+			err:      "no such file",
+		},
+		{
+			name:     "values are not expanded again",
+			contents: `password = "${ASGARD_TEST_FILE}"`,
+			expected: `password = "@file:` + nested + `"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := interpolate("test.toml", []byte(tt.contents))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		dir      map[string]string
+		inputs   []testInput
+		tags     map[string]string
+		err      string
+	}{
+		{
+			name: "merged",
+			contents: `
+[Agent]
+  interval = "5s"
+[Tags]
+  dc = "eu"
+[[inputs.test]]
+  port = 1
+`,
+			dir: map[string]string{
+				"b.toml":     "[[inputs.test]]\n  port = 3\n",
+				"a.toml":     "[Agent]\n  flush_interval = \"5s\"\n[Tags]\n  rack = \"1\"\n[[inputs.test]]\n  port = 2\n",
+				"c.toml.bak": "[[inputs.test]]\n  port = 4\n",
+			},
+			inputs: []testInput{{Port: 1}, {Port: 2}, {Port: 3}},
+			tags:   map[string]string{"dc": "eu", "rack": "1"},
+		},
+		{
+			name:     "merged lists",
+			contents: "[InputFilters]\n  inputs = [\"test\"]\n",
+			dir:      map[string]string{"a.toml": "[InputFilters]\n  inputs = [\"test\"]\n"},
+			inputs:   []testInput{{Port: 8080}},
+			tags:     map[string]string{},
+		},
+		{
+			name:     "conflicting agent setting",
+			contents: "[Agent]\n  interval = \"5s\"\n",
+			dir:      map[string]string{"a.toml": "[Agent]\n  interval = \"10s\"\n"},
+			err:      "Conflicting setting Agent.interval",
+		},
+		{
+			name:     "conflicting tag",
+			contents: "[Tags]\n  dc = \"eu\"\n",
+			dir:      map[string]string{"a.toml": "[Tags]\n  dc = \"us\"\n"},
+			err:      "Conflicting setting Tags.dc",
+		},
+		{
+			name:     "error in directory file",
+			contents: "",
+			dir:      map[string]string{"a.toml": "[[inputs.test]]\n  port = \"a\"\n"},
+			err:      "a.toml: Error parsing [[inputs.test]]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, tt.dir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if settings := inputSettings(c); !reflect.DeepEqual(settings, tt.inputs) {
+				t.Errorf("expected inputs %+v, got %+v", tt.inputs, settings)
+			}
+			if !reflect.DeepEqual(c.Tags, tt.tags) {
+				t.Errorf("expected tags %v, got %v", tt.tags, c.Tags)
+			}
+		})
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		errs     []string
+	}{
+		{
+			name:     "valid",
+			contents: "[Agent]\n  interval = \"5s\"\n[[inputs.test]]\n  port = 1\n",
+		},
+		{
+			name:     "unknown plugin setting",
+			contents: "[[inputs.test]]\n  prot = 1\n",
+			errs:     []string{"unknown setting inputs.test.prot"},
+		},
+		{
+			name:     "unknown agent setting",
+			contents: "[Agent]\n  intervall = \"5s\"\n",
+			errs:     []string{"unknown setting Agent.intervall"},
+		},
+		{
+			name:     "settings of unknown plugins are not reported",
+			contents: "[[inputs.missing]]\n  port = 1\n",
+			errs:     []string{"Undefined but requested input: missing"},
+		},
+		{
+			name:     "duration as a number",
+			contents: "[Agent]\n  interval = 10\n",
+			errs:     []string{"interval must be a duration string"},
+		},
+		{
+			name:     "invalid duration",
+			contents: "[[inputs.test]]\n  interval = \"ten\"\n",
+			errs:     []string{"Error parsing [[inputs.test]]"},
+		},
+		{
+			name:     "invalid agent values",
+			contents: "[Agent]\n  log_format = \"xml\"\n  health_max_buffer_fill = 2.0\n",
+			errs:     []string{`invalid log_format "xml"`, "invalid health_max_buffer_fill 2"},
+		},
+		{
+			name:     "every error is reported",
+			contents: "[[inputs.test]]\n  prot = 1\n[[outputs.missing]]\n[[outputs.test]]\n  uri = \"a\"\n",
+			errs: []string{
+				"Undefined but requested output: missing",
+				"unknown setting inputs.test.prot",
+				"unknown setting outputs.test.uri",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(t, tt.contents, nil)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tt.errs)
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("expected error containing %q, got %s", e, err)
+				}
+			}
+			if n := strings.Count(err.Error(), "\n"); len(tt.errs) > 1 && n != len(tt.errs) {
+				t.Errorf("expected %d errors, got %s", len(tt.errs), err)
+			}
+		})
+	}
+}
+
+func TestLoadSelected(t *testing.T) {
+	contents := `
+[InputFilters]
+  inputs = ["other"]
+[[inputs.test]]
+  port = 1
+[[outputs.test]]
+  url = "a"
+`
+
+	tests := []struct {
+		name            string
+		contents        string
+		selectedInputs  []string
+		selectedOutputs []string
+		inputs          []string
+		ports           []int
+		outputs         int
+		err             string
+	}{
+		{
+			name:     "not selected",
+			contents: contents,
+			inputs:   []string{"test", "other"},
+			ports:    []int{1, 0},
+			outputs:  1,
+		},
+		{
+			name:           "selected table",
+			contents:       contents,
+			selectedInputs: []string{"test"},
+			inputs:         []string{"test"},
+			ports:          []int{1},
+			outputs:        1,
+		},
+		{
+			name:           "selected without a table",
+			contents:       "[[outputs.test]]\n",
+			selectedInputs: []string{"test"},
+			inputs:         []string{"test"},
+			ports:          []int{8080},
+			outputs:        1,
+		},
+		{
+			name:            "unknown output",
+			contents:        contents,
+			selectedInputs:  []string{"other"},
+			selectedOutputs: []string{"nope"},
+			err:             "Undefined but requested output: nope",
+		},
+		{
+			name:           "unknown input",
+			contents:       contents,
+			selectedInputs: []string{"nope"},
+			err:            "Undefined but requested input: nope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "asgard-config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "asgard.toml")
+			if err := ioutil.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewConfig()
+			c.SelectedInputs = tt.selectedInputs
+			c.SelectedOutputs = tt.selectedOutputs
+			err = c.LoadConfig(path, "")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var names []string
+			var ports []int
+			for _, ri := range c.Inputs {
+				names = append(names, ri.Config.Name)
+				ports = append(ports, ri.Input.(*testInput).Port)
+			}
+			if !reflect.DeepEqual(names, tt.inputs) || !reflect.DeepEqual(ports, tt.ports) {
+				t.Errorf("expected inputs %q with ports %v, got %q with %v", tt.inputs, tt.ports, names, ports)
+			}
+			if len(c.Outputs) != tt.outputs {
+				t.Errorf("expected %d outputs, got %d", tt.outputs, len(c.Outputs))
+			}
+		})
+	}
+}
+
+func TestLoadAgentDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		check    func(a *AgentConfig) bool
+		err      string
+	}{
+		{
+			name: "duration strings",
+			contents: `
+[Agent]
+  interval = "10s"
+  precision = "1ms"
+  collection_jitter = "2s"
+  flush_interval = "1m"
+  flush_jitter = "500ms"
+  round_interval = true
+`,
+			check: func(a *AgentConfig) bool {
+				return a.Interval.Duration == 10*time.Second &&
+					a.Precision.Duration == time.Millisecond &&
+					a.CollectionJitter.Duration == 2*time.Second &&
+					a.FlushInterval.Duration == time.Minute &&
+					a.FlushJitter.Duration == 500*time.Millisecond &&
+					a.RoundInterval
+			},
+		},
+		{
+			name:     "number",
+			contents: "[Agent]\n  interval = 10000\n",
+			err:      `interval must be a duration string such as "10s", not a number`,
+		},
+		{
+			name:     "number in another case",
+			contents: "[Agent]\n  Flush_Interval = 10\n",
+			err:      "must be a duration string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.check(c.Agent) {
+				t.Errorf("unexpected agent settings %+v", c.Agent)
+			}
+		})
+	}
+}
+
+func TestLoadInit(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		errs     []string
+	}{
+		{
+			name:     "initialized",
+			contents: "[[inputs.init]]\n[[outputs.init]]\n",
+		},
+		{
+			name:     "failed input",
+			contents: "[[inputs.init]]\n  fail = true\n",
+			errs:     []string{"Error initializing [[inputs.init]]: invalid settings"},
+		},
+		{
+			name:     "failed output",
+			contents: "[[outputs.init]]\n  fail = true\n",
+			errs:     []string{"Error initializing [[outputs.init]]: invalid settings"},
+		},
+		{
+			name:     "every failure is reported",
+			contents: "[[inputs.init]]\n  fail = true\n[[outputs.init]]\n  fail = true\n",
+			errs: []string{
+				"Error initializing [[inputs.init]]",
+				"Error initializing [[outputs.init]]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, nil)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				for _, ri := range c.Inputs {
+					if !ri.Input.(*initInput).initialized {
+						t.Error("expected the input to be initialized")
+					}
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tt.errs)
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("expected error containing %q, got %s", e, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSecretRefs(t *testing.T) {
+	store := "[[secretstores.test]]\n  id = \"local\"\n"
+
+	tests := []struct {
+		name     string
+		contents string
+		password string
+		err      string
+	}{
+		{
+			name:     "credential",
+			contents: store + "[[outputs.test]]\n  password = \"@{local:s3cr3t}\"\n",
+			password: "s3cr3t",
+		},
+		{
+			name:     "plain setting",
+			contents: store + "[[outputs.test]]\n  url = \"http://@{local:user}@a\"\n",
+			err:      "Error parsing [[outputs.test]]: url can't reference a secret",
+		},
+		{
+			name:     "list",
+			contents: store + "[[inputs.test]]\n  servers = [\"a\", \"@{local:b}\"]\n",
+			err:      "Error parsing [[inputs.test]]: servers can't reference a secret",
+		},
+		{
+			name:     "tag",
+			contents: store + "[[inputs.test]]\n  [inputs.test.tags]\n    dc = \"@{local:dc}\"\n",
+			err:      "Error parsing [[inputs.test]]: tags can't reference a secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadConfig(t, tt.contents, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			secrets.SetStores(c.SecretStores)
+			defer secrets.SetStores(map[string]asgard.SecretStore{})
+			password, err := c.Outputs[0].Output.(*testOutput).Password.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if password != tt.password {
+				t.Errorf("expected password %q, got %q", tt.password, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anabiozz/asgard/internal"
+)
+
+// maxRemoteConfigSize is the size of the largest config accepted from a
+// server, so a misbehaving server can't exhaust the memory of the agent
+const maxRemoteConfigSize = 4 * 1024 * 1024
+
+// IsURL reports whether path is an http:// or https:// URL rather than a file
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// RemoteConfig holds the settings used to fetch a config from a URL
+type RemoteConfig struct {
+	URL string
+	// CachePath is the file the last good config is kept in, no copy is
+	// kept when it is empty
+	CachePath string
+	Timeout   time.Duration
+	// Interpolate expands the ${VAR} and @file:/path references of the
+	// fetched config like those of config files. It is off by default, so
+	// the server can't read the environment and the files of the host.
+	Interpolate bool
+
+	// Path to CA file
+	SSLCA string
+	// Path to host cert file
+	SSLCert string
+	// Path to cert key file
+	SSLKey string
+	// Use SSL but skip chain & host verification
+	InsecureSkipVerify bool
+}
+
+// Remote is a config served over HTTP. The last fetched copy is kept in
+// memory for LoadRemoteConfig, once it loaded successfully it is also
+// written to CachePath, so it can still be used when the server is
+// unreachable at the next start.
+type Remote struct {
+	RemoteConfig
+
+	client *http.Client
+
+	mu       sync.Mutex
+	contents []byte
+	// etag and lastModified are the validators of contents
+	etag         string
+	lastModified string
+	// loadedETag and loadedLastModified are the validators of the config
+	// that was last loaded, they are sent with the requests so a config that
+	// failed to load is fetched again
+	loadedETag         string
+	loadedLastModified string
+}
+
+// NewRemote creates a Remote from rc, it doesn't fetch anything yet
+func NewRemote(rc RemoteConfig) (*Remote, error) {
+	tlsCfg, err := internal.GetTLSConfig(rc.SSLCert, rc.SSLKey, rc.SSLCA, rc.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Timeout == 0 {
+		rc.Timeout = 10 * time.Second
+	}
+	return &Remote{
+		RemoteConfig: rc,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsCfg,
+			},
+			Timeout: rc.Timeout,
+		},
+	}, nil
+}
+
+// Load fetches the config, falling back to the cached copy when the server
+// can't be reached.
+func (r *Remote) Load() error {
+	_, err := r.Fetch()
+	if err == nil {
+		return nil
+	}
+	if r.CachePath == "" {
+		return err
+	}
+	contents, cacheErr := ioutil.ReadFile(r.CachePath)
+	if cacheErr != nil {
+		return fmt.Errorf("%s, and no cached copy: %s", err, cacheErr)
+	}
+	log.Printf("E! %s, using cached copy %s", err, r.CachePath)
+
+	r.mu.Lock()
+	r.contents = contents
+	r.mu.Unlock()
+	return nil
+}
+
+// Fetch requests the config, sending the ETag and Last-Modified headers of
+// the config last loaded so an unchanged config isn't transferred again. It
+// reports whether a new config was received.
+func (r *Remote) Fetch() (bool, error) {
+	req, err := http.NewRequest("GET", r.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	if r.loadedETag != "" {
+		req.Header.Set("If-None-Match", r.loadedETag)
+	}
+	if r.loadedLastModified != "" {
+		req.Header.Set("If-Modified-Since", r.loadedLastModified)
+	}
+	r.mu.Unlock()
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Error fetching config from %s: %s", r.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("Error fetching config from %s: %s", r.URL, resp.Status)
+	}
+
+	// one more byte than allowed is read to tell a config of the maximum
+	// size from a larger one
+	contents, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return false, fmt.Errorf("Error fetching config from %s: %s", r.URL, err)
+	}
+	if len(contents) > maxRemoteConfigSize {
+		return false, fmt.Errorf("Error fetching config from %s: config larger than %d bytes", r.URL, maxRemoteConfigSize)
+	}
+
+	r.mu.Lock()
+	r.etag = resp.Header.Get("ETag")
+	r.lastModified = resp.Header.Get("Last-Modified")
+	r.contents = contents
+	r.mu.Unlock()
+	return true, nil
+}
+
+// loaded records contents as the last known good config: it is cached and,
+// when it is still the last fetched config, its validators are sent with the
+// next requests
+func (r *Remote) loaded(contents []byte) {
+	r.mu.Lock()
+	if bytes.Equal(contents, r.contents) {
+		r.loadedETag = r.etag
+		r.loadedLastModified = r.lastModified
+	}
+	r.mu.Unlock()
+
+	if r.CachePath == "" {
+		return
+	}
+	if err := writeCache(r.CachePath, contents); err != nil {
+		log.Printf("E! Could not cache config in %s: %s", r.CachePath, err)
+	}
+}
+
+// Contents returns the last fetched config
+func (r *Remote) Contents() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.contents
+}
+
+// Poll fetches the config every interval and sends on the returned channel
+// when a new one was received. Failed requests are logged and the current
+// config is kept. Polling stops when stop is closed.
+func (r *Remote) Poll(interval time.Duration, stop chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				changed, err := r.Fetch()
+				if err != nil {
+					log.Printf("E! %s", err)
+					continue
+				}
+				if !changed {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// writeCache replaces the cached config in one step, so an interrupted write
+// never leaves a truncated copy behind. The config may contain credentials,
+// only the owner may read it.
+func writeCache(path string, contents []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// configServer serves body with an ETag changing with every body, it records
+// the If-None-Match header of the last request
+type configServer struct {
+	mu          sync.Mutex
+	body        string
+	version     int
+	ifNoneMatch string
+}
+
+func (s *configServer) set(body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	s.version++
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ifNoneMatch = r.Header.Get("If-None-Match")
+	etag := fmt.Sprintf(`"%d"`, s.version)
+	if s.ifNoneMatch == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, s.body)
+}
+
+func TestRemoteETag(t *testing.T) {
+	s := &configServer{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	r, err := NewRemote(RemoteConfig{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name        string
+		body        string
+		ifNoneMatch string
+		changed     bool
+		loads       bool
+	}{
+		{name: "first config", body: "[[inputs.test]]\n", changed: true, loads: true},
+		{name: "unchanged", ifNoneMatch: `"1"`, changed: false, loads: true},
+		{name: "broken config", body: "[[inputs.test]]\n  prot = 1\n", ifNoneMatch: `"1"`, changed: true, loads: false},
+		{name: "broken config is fetched again", ifNoneMatch: `"1"`, changed: true, loads: false},
+		{name: "fixed config", body: "[[inputs.test]]\n  port = 1\n", ifNoneMatch: `"1"`, changed: true, loads: true},
+		{name: "fixed config is not fetched again", ifNoneMatch: `"3"`, changed: false, loads: true},
+	}
+
+	for _, step := range steps {
+		if step.body != "" {
+			s.set(step.body)
+		}
+		changed, err := r.Fetch()
+		if err != nil {
+			t.Fatalf("%s: Error fetching: %s", step.name, err)
+		}
+		if s.ifNoneMatch != step.ifNoneMatch {
+			t.Errorf("%s: expected If-None-Match %q, got %q", step.name, step.ifNoneMatch, s.ifNoneMatch)
+		}
+		if changed != step.changed {
+			t.Errorf("%s: expected changed %v, got %v", step.name, step.changed, changed)
+		}
+		err = NewConfig().LoadRemoteConfig(r, "")
+		if (err == nil) != step.loads {
+			t.Errorf("%s: expected loads %v, got %v", step.name, step.loads, err)
+		}
+	}
+}
+
+func TestRemoteInterpolate(t *testing.T) {
+	os.Setenv("ASGARD_TEST_SERVER", "a")
+	body := "[[inputs.test]]\n  servers = [\"${ASGARD_TEST_SERVER}\", \"@file:/etc/passwd\"]\n"
+
+	tests := []struct {
+		name        string
+		interpolate bool
+		body        string
+		servers     []string
+		err         bool
+	}{
+		{
+			name:    "off",
+			body:    body,
+			servers: []string{"${ASGARD_TEST_SERVER}", "@file:/etc/passwd"},
+		},
+		{
+			name:        "on",
+			interpolate: true,
+			body:        "[[inputs.test]]\n  servers = [\"${ASGARD_TEST_SERVER}\", \"$${ASGARD_TEST_SERVER}\"]\n",
+			servers:     []string{"a", "${ASGARD_TEST_SERVER}"},
+		},
+		{
+			name:        "on with an unset variable",
+			interpolate: true,
+			body:        "[[inputs.test]]\n  servers = [\"${ASGARD_TEST_UNSET}\"]\n",
+			err:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &configServer{}
+			s.set(tt.body)
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			r, err := NewRemote(RemoteConfig{URL: ts.URL, Interpolate: tt.interpolate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Load(); err != nil {
+				t.Fatal(err)
+			}
+			c := NewConfig()
+			err = c.LoadRemoteConfig(r, "")
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if servers := inputSettings(c)[0].Servers; !reflect.DeepEqual(servers, tt.servers) {
+				t.Errorf("expected servers %q, got %q", tt.servers, servers)
+			}
+		})
+	}
+}
+
+func TestRemoteCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "cache.toml")
+
+	s := &configServer{}
+	s.set("[[inputs.test]]\n  port = 1\n")
+	ts := httptest.NewServer(s)
+	r, err := NewRemote(RemoteConfig{URL: ts.URL, CachePath: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfig().LoadRemoteConfig(r, ""); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+
+	tests := []struct {
+		name      string
+		cachePath string
+		err       bool
+	}{
+		{name: "cached", cachePath: cache},
+		{name: "no cache", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRemote(RemoteConfig{URL: ts.URL, CachePath: tt.cachePath})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.Load()
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			c := NewConfig()
+			if err := c.LoadRemoteConfig(r, ""); err != nil {
+				t.Fatal(err)
+			}
+			if settings := inputSettings(c); len(settings) != 1 || settings[0].Port != 1 {
+				t.Errorf("expected the cached config, got %+v", settings)
+			}
+		})
+	}
+}
+
+func TestRemoteSizeLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		err  bool
+	}{
+		{name: "maximum size", size: maxRemoteConfigSize},
+		{name: "too large", size: maxRemoteConfigSize + 1, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &configServer{}
+			s.set(strings.Repeat("#", tt.size))
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			r, err := NewRemote(RemoteConfig{URL: ts.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = r.Fetch()
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !tt.err && len(r.Contents()) != tt.size {
+				t.Errorf("expected %d bytes, got %d", tt.size, len(r.Contents()))
+			}
+		})
+	}
+}
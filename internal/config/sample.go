@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/anabiozz/asgard/plugins/aggregators"
+	"github.com/anabiozz/asgard/plugins/inputs"
+	"github.com/anabiozz/asgard/plugins/outputs"
+	"github.com/anabiozz/asgard/plugins/processors"
+	"github.com/anabiozz/asgard/plugins/secretstores"
+	"github.com/anabiozz/asgard/plugins/serializers"
+)
+
+// defaultInputs and defaultOutputs are the plugins left enabled in a sample
+// config generated without filters, all others are commented out.
+var (
+	defaultInputs  = []string{"cpu", "mem", "disk", "diskio", "kernel", "processes", "netstat", "net"}
+	defaultOutputs = []string{"influxdb"}
+)
+
+const sampleHeader = `# Asgard configuration
+#
+# Plugins are configured with [[inputs.<name>]] and [[outputs.<name>]] tables,
+# a table may be repeated to run several instances of a plugin. Every plugin
+# table accepts an alias and the metric filters namepass, namedrop, fieldpass,
+# fielddrop, taginclude, tagexclude, [<plugin>.tagpass] and [<plugin>.tagdrop].
+# Input tables also accept interval, timeout (of a gather, defaults to the
+# interval), name_override, name_prefix, name_suffix and a
+# [inputs.<name>.tags] sub-table.
+#
+# Processors transform the metrics before they reach the outputs, they are
+# configured with [[processors.<name>]] tables and run in the order of their
+# tables, or by increasing "order" setting when one is given. A processor table
+# accepts an alias and namepass, namedrop, [<plugin>.tagpass] and
+# [<plugin>.tagdrop], they select the metrics the processor is applied to.
+#
+# Aggregators compute metrics over periods from the processed metrics, they
+# are configured with [[aggregators.<name>]] tables. Next to period, delay
+# (waited for late metrics after a period ended), grace (accepts metrics older
+# than the current period) and drop_original, an aggregator table accepts the
+# settings of an input table but interval and timeout.
+#
+# Values may reference environment variables as ${VAR} or ${VAR:-default},
+# "@file:/path" is replaced by the contents of the file. Write $${ for a
+# literal ${.
+
+`
+
+const sampleAgentConfig = `# Configuration for the agent
+[Agent]
+  ## Default interval at which inputs are gathered
+  interval = "10s"
+  ## Gather on multiples of interval, ie on :00, :10, :20 for "10s"
+  round_interval = true
+  ## Timestamps are rounded to precision, when "0s" to the order of interval
+  ## with a maximum of "1s"
+  precision = "0s"
+  ## Sleep a random time up to collection_jitter before each gather
+  collection_jitter = "0s"
+
+  ## Interval at which outputs are flushed
+  flush_interval = "10s"
+  ## Sleep a random time up to flush_jitter before each flush
+  flush_jitter = "0s"
+
+  ## Outputs are written in batches of at most metric_batch_size metrics
+  metric_batch_size = 1000
+  ## Maximum number of unwritten metrics buffered per output
+  metric_buffer_limit = 10000
+  ## Flush as soon as a buffer is full, regardless of flush_interval
+  flush_buffer_when_full = false
+
+  ## Run in debug mode
+  debug = false
+  ## Only log errors
+  quiet = false
+  ## File to send logs to, stderr when empty
+  logfile = ""
+  ## Rotate the logfile once it reaches the size, never when "0"
+  logfile_rotation_max_size = "10MB"
+  ## Number of rotated logfiles kept
+  logfile_rotation_max_archives = 5
+  ## Log format, "text" or "json"
+  log_format = "text"
+
+  ## Override the hostname, os.Hostname() is used when empty
+  hostname = ""
+  ## Don't add the host tag to metrics
+  omit_hostname = false
+
+  ## Serve /health and /status over HTTP on the address, ie "localhost:8125",
+  ## disabled when empty
+  health_listen = ""
+  ## /health fails once every write to an output failed for longer than
+  ## health_max_failing_time, or the metrics an output failed to write fill
+  ## more than the health_max_buffer_fill ratio of its buffer, "0s" and 0
+  ## disable the checks
+  health_max_failing_time = "5m"
+  health_max_buffer_fill = 0.9
+
+  ## Serve the admin API on a unix socket, ie "unix:///run/asgard.sock", or a
+  ## loopback address such as "localhost:8126", disabled when empty
+  admin_listen = ""
+
+# Tags added to every metric
+[Tags]
+  # dc = "us-east-1"
+
+`
+
+// PrintSampleConfig writes a commented config with the agent section and the
+// sample configuration of every output, processor, aggregator and input plugin
+// to w. When filters are given only the inputs and outputs named in them are
+// written, otherwise every plugin is written and all but the default ones are
+// commented out. Processors and aggregators are always commented out.
+func PrintSampleConfig(w io.Writer, inputFilters, outputFilters []string) error {
+	for _, name := range inputFilters {
+		if _, ok := inputs.Inputs[name]; !ok {
+			return fmt.Errorf("Undefined but requested input: %s", name)
+		}
+	}
+	for _, name := range outputFilters {
+		if _, ok := outputs.Outputs[name]; !ok {
+			return fmt.Errorf("Undefined but requested output: %s", name)
+		}
+	}
+
+	fmt.Fprint(w, sampleHeader)
+	fmt.Fprint(w, sampleAgentConfig)
+
+	fmt.Fprint(w, "\n###############################################################################\n")
+	fmt.Fprint(w, "#                            SECRET STORES                                    #\n")
+	fmt.Fprint(w, "###############################################################################\n")
+	var stores []string
+	for name := range secretstores.SecretStores {
+		stores = append(stores, name)
+	}
+	sort.Strings(stores)
+	for _, name := range stores {
+		store := secretstores.SecretStores[name]()
+		config := fmt.Sprintf(`
+  ## Plugins reference the secrets of the store as @{%s:<key>}
+  id = "%s"
+`, name, name) + store.SampleConfig()
+		printPlugin(w, "secretstores", name, store.Description(), config, false)
+	}
+
+	fmt.Fprint(w, "\n###############################################################################\n")
+	fmt.Fprint(w, "#                            OUTPUT PLUGINS                                   #\n")
+	fmt.Fprint(w, "###############################################################################\n")
+	var registered []string
+	for name := range outputs.Outputs {
+		registered = append(registered, name)
+	}
+	for _, name := range sampleNames(registered, outputFilters) {
+		output := outputs.Outputs[name]()
+		config := output.SampleConfig()
+		if _, ok := output.(serializers.SerializerOutput); ok {
+			config += serializerSampleConfig()
+		}
+		enabled := len(outputFilters) > 0 || containsName(defaultOutputs, name)
+		printPlugin(w, "outputs", name, output.Description(), config, enabled)
+	}
+
+	fmt.Fprint(w, "\n###############################################################################\n")
+	fmt.Fprint(w, "#                            PROCESSOR PLUGINS                                #\n")
+	fmt.Fprint(w, "###############################################################################\n")
+	registered = registered[:0]
+	for name := range processors.Processors {
+		registered = append(registered, name)
+	}
+	for _, name := range sampleNames(registered, nil) {
+		processor := processors.Processors[name]()
+		printPlugin(w, "processors", name, processor.Description(), processor.SampleConfig(), false)
+	}
+
+	fmt.Fprint(w, "\n###############################################################################\n")
+	fmt.Fprint(w, "#                            AGGREGATOR PLUGINS                               #\n")
+	fmt.Fprint(w, "###############################################################################\n")
+	registered = registered[:0]
+	for name := range aggregators.Aggregators {
+		registered = append(registered, name)
+	}
+	for _, name := range sampleNames(registered, nil) {
+		aggregator := aggregators.Aggregators[name]()
+		printPlugin(w, "aggregators", name, aggregator.Description(), aggregator.SampleConfig(), false)
+	}
+
+	fmt.Fprint(w, "\n###############################################################################\n")
+	fmt.Fprint(w, "#                            INPUT PLUGINS                                    #\n")
+	fmt.Fprint(w, "###############################################################################\n")
+	registered = registered[:0]
+	for name := range inputs.Inputs {
+		registered = append(registered, name)
+	}
+	for _, name := range sampleNames(registered, inputFilters) {
+		input := inputs.Inputs[name]()
+		enabled := len(inputFilters) > 0 || containsName(defaultInputs, name)
+		printPlugin(w, "inputs", name, input.Description(), input.SampleConfig(), enabled)
+	}
+	return nil
+}
+
+// sampleNames returns filters, or every registered name when no filters are
+// given, in sorted order.
+func sampleNames(registered, filters []string) []string {
+	names := filters
+	if len(names) == 0 {
+		names = registered
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	return names
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// serializerSampleConfig documents the data_format setting of outputs that
+// take a serializer.
+func serializerSampleConfig() string {
+	return fmt.Sprintf(`
+  ## Data format to output, one of: %s
+  # data_format = "json"
+`, strings.Join(serializers.DataFormats, ", "))
+}
+
+// printPlugin writes the table of one plugin, commenting out every line that
+// isn't already a comment when the plugin isn't enabled.
+func printPlugin(w io.Writer, section, name, description, config string, enabled bool) {
+	fmt.Fprintf(w, "\n# %s\n", description)
+	if enabled {
+		fmt.Fprintf(w, "[[%s.%s]]\n", section, name)
+	} else {
+		fmt.Fprintf(w, "# [[%s.%s]]\n", section, name)
+	}
+
+	config = strings.Trim(config, "\n")
+	if config == "" {
+		fmt.Fprint(w, "  # no configuration\n")
+		return
+	}
+	for _, line := range strings.Split(config, "\n") {
+		if !enabled && strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			line = "#" + line
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintSampleConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		inputFilters  []string
+		outputFilters []string
+		contains      []string
+		inputs        int
+		outputs       int
+		err           string
+	}{
+		{
+			name:     "every plugin commented out",
+			contains: []string{"[Agent]", "# [[inputs.test]]", "# [[outputs.test]]"},
+		},
+		{
+			name:          "filtered plugins enabled",
+			inputFilters:  []string{"test"},
+			outputFilters: []string{"test"},
+			contains:      []string{"\n[[inputs.test]]\n", "\n[[outputs.test]]\n"},
+			inputs:        1,
+			outputs:       1,
+		},
+		{
+			name:         "unknown input",
+			inputFilters: []string{"nope"},
+			err:          "Undefined but requested input: nope",
+		},
+		{
+			name:          "unknown output",
+			outputFilters: []string{"nope"},
+			err:           "Undefined but requested output: nope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := PrintSampleConfig(&buf, tt.inputFilters, tt.outputFilters)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sample := buf.String()
+			for _, s := range tt.contains {
+				if !strings.Contains(sample, s) {
+					t.Errorf("expected the sample to contain %q", s)
+				}
+			}
+
+			// the sample is a valid config
+			c, err := loadConfig(t, sample, nil)
+			if err != nil {
+				t.Fatalf("Error loading the sample: %s", err)
+			}
+			if len(c.Inputs) != tt.inputs || len(c.Outputs) != tt.outputs {
+				t.Errorf("expected %d inputs and %d outputs, got %d and %d",
+					tt.inputs, tt.outputs, len(c.Inputs), len(c.Outputs))
+			}
+		})
+	}
+}
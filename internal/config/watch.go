@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// Watch polls the config files that LoadConfig(path, dir) would load every
+// interval and sends on the returned channel when one of them is modified,
+// added or removed. Changes are coalesced while nobody receives them.
+// Watching stops when stop is closed.
+func Watch(path, dir string, interval time.Duration, stop chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		last := fileStates(path, dir)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				current := fileStates(path, dir)
+				if sameStates(last, current) {
+					continue
+				}
+				last = current
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// fileState is what Watch compares to detect a modified file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileStates returns the state of every config file, files that can't be
+// read are left out so they count as removed.
+func fileStates(path, dir string) map[string]fileState {
+	states := make(map[string]fileState)
+	paths, err := configPaths(path, dir)
+	if err != nil {
+		return states
+	}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		states[p] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	return states
+}
+
+func sameStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, s := range a {
+		if t, ok := b[p]; !ok || !t.modTime.Equal(s.modTime) || t.size != s.size {
+			return false
+		}
+	}
+	return true
+}
@@ -32,6 +32,12 @@ type Duration struct {
 	Duration time.Duration
 }
 
+// UnmarshalText parses the duration from the TOML config file when it is
+// decoded by BurntSushi/toml, which hands over the raw string or number.
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.UnmarshalTOML(text)
+}
+
 // UnmarshalTOML parses the duration from the TOML config file
 func (d *Duration) UnmarshalTOML(b []byte) error {
 	var err error
@@ -64,6 +70,41 @@ func (d *Duration) UnmarshalTOML(b []byte) error {
 		return nil
 	}
 
+	return fmt.Errorf("invalid duration %s", b)
+}
+
+// Size is a size in bytes that may be given with a unit, ie "10MB"
+type Size struct {
+	Size int64
+}
+
+// sizeUnits are the units Size accepts, in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// UnmarshalText parses the size from the TOML config file
+func (s *Size) UnmarshalText(text []byte) error {
+	str := strings.ToUpper(strings.TrimSpace(string(text)))
+	factor := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %s", text)
+	}
+	s.Size = n * factor
 	return nil
 }
 
@@ -0,0 +1,183 @@
+// Package logger routes the standard logger through a level filter.
+//
+// Log lines are expected to start with a level: "E! ", "W! ", "I! " or
+// "D! ", optionally followed by the plugin name in brackets. Lines without a
+// level are logged as info.
+//
+//	log.Printf("E! [outputs.influxdb] could not write: %s", err)
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anabiozz/asgard/internal/rotate"
+)
+
+// Levels in increasing verbosity
+const (
+	LevelError = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = []string{"error", "warn", "info", "debug"}
+var levelLetters = []string{"E", "W", "I", "D"}
+
+// Config holds the logging settings of the agent
+type Config struct {
+	// Debug logs debug messages
+	Debug bool
+	// Quiet only logs errors
+	Quiet bool
+	// Logfile is the file to log to, stderr when empty
+	Logfile string
+	// RotationMaxSize rotates the log file once it reaches the size in
+	// bytes, 0 disables rotation
+	RotationMaxSize int64
+	// RotationMaxArchives is the number of rotated files kept
+	RotationMaxArchives int
+	// Format is "text" or "json"
+	Format string
+}
+
+// writer filters and formats the lines written by the standard logger
+type writer struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  int
+	json   bool
+	closer io.Closer
+}
+
+var current *writer
+
+// Setup applies c to the standard logger. It may be called again, ie when the
+// config is reloaded, the previous log file is closed then.
+func Setup(c Config) error {
+	w := &writer{out: os.Stderr, level: LevelInfo}
+	switch {
+	case c.Debug:
+		w.level = LevelDebug
+	case c.Quiet:
+		w.level = LevelError
+	}
+
+	switch c.Format {
+	case "", "text":
+	case "json":
+		w.json = true
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", c.Format)
+	}
+
+	if c.Logfile != "" {
+		f, err := rotate.NewFileWriter(c.Logfile, c.RotationMaxSize, c.RotationMaxArchives)
+		if err != nil {
+			return fmt.Errorf("Error opening logfile: %s", err)
+		}
+		w.out = f
+		w.closer = f
+	}
+
+	log.SetFlags(0)
+	log.SetOutput(w)
+	previous := current
+	current = w
+	if previous != nil && previous.closer != nil {
+		previous.mu.Lock()
+		previous.closer.Close()
+		previous.mu.Unlock()
+	}
+	return nil
+}
+
+// Write logs one line of the standard logger
+func (w *writer) Write(b []byte) (int, error) {
+	level, plugin, msg := parse(strings.TrimRight(string(b), "\n"))
+	if level > w.level {
+		return len(b), nil
+	}
+
+	now := time.Now().UTC()
+	var line []byte
+	if w.json {
+		entry := map[string]string{
+			"time":  now.Format(time.RFC3339),
+			"level": levelNames[level],
+			"msg":   msg,
+		}
+		if plugin != "" {
+			entry["plugin"] = plugin
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(entry)
+		line = buf.Bytes()
+	} else {
+		if plugin != "" {
+			msg = "[" + plugin + "] " + msg
+		}
+		line = []byte(fmt.Sprintf("%s %s! %s\n", now.Format(time.RFC3339), levelLetters[level], msg))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// legacyPrefixes are the level prefixes used before the "X! " ones
+var legacyPrefixes = []struct {
+	prefix string
+	level  int
+}{
+	{"ERROR:", LevelError},
+	{"ERROR ", LevelError},
+	{"WARN:", LevelWarn},
+	{"INFO:", LevelInfo},
+	{"DEBUG:", LevelDebug},
+}
+
+// parse splits a log line into its level, plugin and message
+func parse(line string) (int, string, string) {
+	level := LevelInfo
+	switch {
+	case len(line) >= 3 && line[1] == '!' && line[2] == ' ':
+		for l, letter := range levelLetters {
+			if line[:1] == letter {
+				level = l
+				line = line[3:]
+				break
+			}
+		}
+	default:
+		for _, p := range legacyPrefixes {
+			if strings.HasPrefix(line, p.prefix) {
+				level = p.level
+				line = strings.TrimSpace(line[len(p.prefix):])
+				break
+			}
+		}
+	}
+
+	var plugin string
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "] "); end > 0 {
+			plugin = line[1:end]
+			line = line[end+2:]
+		}
+	}
+	return level, plugin, line
+}
@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line   string
+		level  int
+		plugin string
+		msg    string
+	}{
+		{line: "E! [outputs.influxdb] could not write", level: LevelError, plugin: "outputs.influxdb", msg: "could not write"},
+		{line: "W! disk almost full", level: LevelWarn, msg: "disk almost full"},
+		{line: "I! [inputs.cpu::a] started", level: LevelInfo, plugin: "inputs.cpu::a", msg: "started"},
+		{line: "D! [agent] gathered", level: LevelDebug, plugin: "agent", msg: "gathered"},
+		{line: "no level", level: LevelInfo, msg: "no level"},
+		{line: "X! unknown level", level: LevelInfo, msg: "X! unknown level"},
+		{line: "ERROR: legacy error", level: LevelError, msg: "legacy error"},
+		{line: "ERROR in plugin", level: LevelError, msg: "in plugin"},
+		{line: "WARN: legacy warning", level: LevelWarn, msg: "legacy warning"},
+		{line: "DEBUG: legacy debug", level: LevelDebug, msg: "legacy debug"},
+		{line: "E! [not a plugin", level: LevelError, msg: "[not a plugin"},
+		{line: "E! [a] [b] nested", level: LevelError, plugin: "a", msg: "[b] nested"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			level, plugin, msg := parse(tt.line)
+			if level != tt.level || plugin != tt.plugin || msg != tt.msg {
+				t.Errorf("expected (%d, %q, %q), got (%d, %q, %q)",
+					tt.level, tt.plugin, tt.msg, level, plugin, msg)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    int
+		json     bool
+		line     string
+		expected string
+	}{
+		{
+			name:     "text",
+			level:    LevelInfo,
+			line:     "E! [inputs.cpu] failed\n",
+			expected: "E! [inputs.cpu] failed\n",
+		},
+		{
+			name:  "filtered",
+			level: LevelInfo,
+			line:  "D! [inputs.cpu] gathered\n",
+		},
+		{
+			name:     "debug",
+			level:    LevelDebug,
+			line:     "D! gathered\n",
+			expected: "D! gathered\n",
+		},
+		{
+			name:  "quiet",
+			level: LevelError,
+			line:  "W! [inputs.cpu] slow\n",
+		},
+		{
+			name:     "json",
+			level:    LevelInfo,
+			json:     true,
+			line:     "W! [inputs.cpu] slow\n",
+			expected: `{"level":"warn","msg":"slow","plugin":"inputs.cpu"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &writer{out: &buf, level: tt.level, json: tt.json}
+			if n, err := w.Write([]byte(tt.line)); err != nil || n != len(tt.line) {
+				t.Fatalf("expected %d bytes written, got %d, %v", len(tt.line), n, err)
+			}
+
+			out := buf.String()
+			switch {
+			case tt.expected == "":
+				if out != "" {
+					t.Errorf("expected nothing logged, got %q", out)
+				}
+			case tt.json:
+				var entry map[string]string
+				if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+					t.Fatalf("Error decoding %q: %s", out, err)
+				}
+				if entry["time"] == "" {
+					t.Errorf("expected a time in %q", out)
+				}
+				delete(entry, "time")
+				encoded, _ := json.Marshal(entry)
+				if string(encoded) != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, encoded)
+				}
+			default:
+				// the line starts with the time
+				if i := strings.Index(out, " "); i == -1 || out[i+1:] != tt.expected {
+					t.Errorf("expected %q after the time, got %q", tt.expected, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// Errors of a plugin instance are logged at most errorLogBurst times per
+// errorLogWindow, the others are only counted.
+const (
+	errorLogBurst  = 5
+	errorLogWindow = time.Minute
+)
+
+// errorStats counts the errors of a plugin instance and rate-limits logging
+// them, so a broken endpoint doesn't flood the log.
+type errorStats struct {
+	mu         sync.Mutex
+	count      int64
+	last       error
+	lastTime   time.Time
+	window     time.Time
+	logged     int
+	suppressed int
+}
+
+// add records err and reports whether it should be logged, along with the
+// number of errors suppressed since the last logged one.
+func (s *errorStats) add(err error, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	s.last = err
+	s.lastTime = now
+
+	if now.Sub(s.window) >= errorLogWindow {
+		s.window = now
+		s.logged = 0
+	}
+	if s.logged >= errorLogBurst {
+		s.suppressed++
+		return false, 0
+	}
+	s.logged++
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return true, suppressed
+}
+
+// ErrorCount is a snapshot of the errors of a plugin instance
+type ErrorCount struct {
+	// Count is the number of errors since the instance was started
+	Count int64
+	// Last is the most recent error and LastTime when it occurred
+	Last     error
+	LastTime time.Time
+}
+
+func (s *errorStats) get() ErrorCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ErrorCount{Count: s.count, Last: s.last, LastTime: s.lastTime}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+)
+
+// nopInput gathers nothing
+type nopInput struct{}
+
+func (nopInput) SampleConfig() string                { return "" }
+func (nopInput) Description() string                 { return "" }
+func (nopInput) Gather(acc asgard.Accumulator) error { return nil }
+
+func TestErrorStats(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+
+	tests := []struct {
+		name string
+		// offsets are the times of the errors, relative to start
+		offsets []time.Duration
+		// logged tells for every error whether it is logged, suppressed
+		// the number of suppressed errors reported with it
+		logged     []bool
+		suppressed []int
+	}{
+		{
+			name:       "burst",
+			offsets:    []time.Duration{0, 1, 2, 3, 4},
+			logged:     []bool{true, true, true, true, true},
+			suppressed: []int{0, 0, 0, 0, 0},
+		},
+		{
+			name:       "suppressed",
+			offsets:    []time.Duration{0, 1, 2, 3, 4, 5, 6},
+			logged:     []bool{true, true, true, true, true, false, false},
+			suppressed: []int{0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:       "next window",
+			offsets:    []time.Duration{0, 1, 2, 3, 4, 5, 6, errorLogWindow, errorLogWindow + 1},
+			logged:     []bool{true, true, true, true, true, false, false, true, true},
+			suppressed: []int{0, 0, 0, 0, 0, 0, 0, 2, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s errorStats
+			for i, offset := range tt.offsets {
+				now := start.Add(offset)
+				logged, suppressed := s.add(fmt.Errorf("error %d", i), now)
+				if logged != tt.logged[i] || suppressed != tt.suppressed[i] {
+					t.Errorf("error %d: expected (%v, %d), got (%v, %d)",
+						i, tt.logged[i], tt.suppressed[i], logged, suppressed)
+				}
+			}
+
+			count := s.get()
+			last := len(tt.offsets) - 1
+			if count.Count != int64(len(tt.offsets)) {
+				t.Errorf("expected %d errors counted, got %d", len(tt.offsets), count.Count)
+			}
+			if count.Last == nil || count.Last.Error() != fmt.Sprintf("error %d", last) ||
+				!count.LastTime.Equal(start.Add(tt.offsets[last])) {
+				t.Errorf("expected the last error to be error %d, got %v at %s", last, count.Last, count.LastTime)
+			}
+		})
+	}
+}
+
+func TestRunningInputLogError(t *testing.T) {
+	input := NewRunningInput(nopInput{}, &InputConfig{Name: "errors"})
+	defer input.UnregisterStats()
+
+	for i := 0; i < errorLogBurst+2; i++ {
+		input.LogError(errors.New("unreachable"))
+	}
+	if count := input.Errors().Count; count != errorLogBurst+2 {
+		t.Errorf("expected %d errors, got %d", errorLogBurst+2, count)
+	}
+	if gathered := input.GatherErrors.Get(); gathered != errorLogBurst+2 {
+		t.Errorf("expected the errors stat to be %d, got %d", errorLogBurst+2, gathered)
+	}
+}
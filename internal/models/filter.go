@@ -1,6 +1,10 @@
 package models
 
-import "github.com/anabiozz/asgard/filter"
+import (
+	"fmt"
+
+	"github.com/anabiozz/asgard/filter"
+)
 
 // TagFilter is the name of a tag, and the values on which to filter
 type TagFilter struct {
@@ -32,6 +36,63 @@ type Filter struct {
 	isActive bool
 }
 
+// Compile all Filter lists into filter.Filter objects.
+func (f *Filter) Compile() error {
+	if len(f.NameDrop) == 0 &&
+		len(f.NamePass) == 0 &&
+		len(f.FieldDrop) == 0 &&
+		len(f.FieldPass) == 0 &&
+		len(f.TagInclude) == 0 &&
+		len(f.TagExclude) == 0 &&
+		len(f.TagPass) == 0 &&
+		len(f.TagDrop) == 0 {
+		return nil
+	}
+
+	f.isActive = true
+	var err error
+	f.nameDrop, err = filter.Compile(f.NameDrop)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'namedrop', %s", err)
+	}
+	f.namePass, err = filter.Compile(f.NamePass)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'namepass', %s", err)
+	}
+
+	f.fieldDrop, err = filter.Compile(f.FieldDrop)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'fielddrop', %s", err)
+	}
+	f.fieldPass, err = filter.Compile(f.FieldPass)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'fieldpass', %s", err)
+	}
+
+	f.tagExclude, err = filter.Compile(f.TagExclude)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'tagexclude', %s", err)
+	}
+	f.tagInclude, err = filter.Compile(f.TagInclude)
+	if err != nil {
+		return fmt.Errorf("Error compiling 'taginclude', %s", err)
+	}
+
+	for i := range f.TagDrop {
+		f.TagDrop[i].filter, err = filter.Compile(f.TagDrop[i].Filter)
+		if err != nil {
+			return fmt.Errorf("Error compiling 'tagdrop', %s", err)
+		}
+	}
+	for i := range f.TagPass {
+		f.TagPass[i].filter, err = filter.Compile(f.TagPass[i].Filter)
+		if err != nil {
+			return fmt.Errorf("Error compiling 'tagpass', %s", err)
+		}
+	}
+	return nil
+}
+
 // IsActive checking if filter is active
 func (f *Filter) IsActive() bool {
 	return f.isActive
@@ -72,6 +133,16 @@ func (f *Filter) Apply(measurement string, fields map[string]interface{}, tags m
 	return true
 }
 
+// Select reports whether the metric of the given measurement name and tags
+// passes the namepass/namedrop and tagpass/tagdrop rules, it doesn't modify
+// the metric.
+func (f *Filter) Select(measurement string, tags map[string]string) bool {
+	if !f.isActive {
+		return true
+	}
+	return f.shouldNamePass(measurement) && f.shouldTagsPass(tags)
+}
+
 // Apply TagInclude and TagExclude filters.
 // modifies the tags map in-place.
 func (f *Filter) filterTags(tags map[string]string) {
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/anabiozz/asgard"
+)
+
+// Logger is the asgard.Logger of a plugin instance, it tags every message
+// with the name of the instance, ie "inputs.influxdb::cluster-a".
+type Logger struct {
+	Name string
+}
+
+// NewLogger returns the logger of the named plugin instance
+func NewLogger(name string) *Logger {
+	return &Logger{Name: name}
+}
+
+// Errorf logs an error message, patterned after log.Printf
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	log.Printf("E! ["+l.Name+"] "+format, args...)
+}
+
+// Error logs an error message, patterned after log.Print
+func (l *Logger) Error(args ...interface{}) {
+	log.Print("E! ["+l.Name+"] ", fmt.Sprint(args...))
+}
+
+// Warnf logs a warning message, patterned after log.Printf
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	log.Printf("W! ["+l.Name+"] "+format, args...)
+}
+
+// Warn logs a warning message, patterned after log.Print
+func (l *Logger) Warn(args ...interface{}) {
+	log.Print("W! ["+l.Name+"] ", fmt.Sprint(args...))
+}
+
+// Infof logs an information message, patterned after log.Printf
+func (l *Logger) Infof(format string, args ...interface{}) {
+	log.Printf("I! ["+l.Name+"] "+format, args...)
+}
+
+// Info logs an information message, patterned after log.Print
+func (l *Logger) Info(args ...interface{}) {
+	log.Print("I! ["+l.Name+"] ", fmt.Sprint(args...))
+}
+
+// Debugf logs a debug message, patterned after log.Printf
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	log.Printf("D! ["+l.Name+"] "+format, args...)
+}
+
+// Debug logs a debug message, patterned after log.Print
+func (l *Logger) Debug(args ...interface{}) {
+	log.Print("D! ["+l.Name+"] ", fmt.Sprint(args...))
+}
+
+var loggerType = reflect.TypeOf((*asgard.Logger)(nil)).Elem()
+
+// SetLoggerOnPlugin hands logger to the plugin, when it has a field declared as
+//
+//	Log asgard.Logger `toml:"-"`
+func SetLoggerOnPlugin(plugin interface{}, logger asgard.Logger) {
+	v := reflect.ValueOf(plugin)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := v.Elem().FieldByName("Log")
+	if !field.IsValid() || !field.CanSet() || field.Type() != loggerType {
+		return
+	}
+	field.Set(reflect.ValueOf(logger))
+}
@@ -25,23 +25,66 @@ func makemetric(
 	measurement string,
 	fields map[string]interface{},
 	tags map[string]string,
+	nameOverride string,
+	namePrefix string,
+	nameSuffix string,
+	pluginTags map[string]string,
+	daemonTags map[string]string,
+	filter Filter,
+	applyFilter bool,
 	mType asgard.ValueType,
 	t time.Time) asgard.Metric {
 
 	if len(fields) == 0 || len(measurement) == 0 {
 		return nil
 	}
-	if tags == nil {
-		tags = make(map[string]string)
+	// the plugin and daemon tags are added to a copy, the caller may reuse
+	// its tags for other metrics
+	copied := make(map[string]string, len(tags)+len(pluginTags)+len(daemonTags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	tags = copied
+
+	// Override measurement name if set
+	if len(nameOverride) != 0 {
+		measurement = nameOverride
+	}
+	// Apply measurement prefix and suffix if set
+	if len(namePrefix) != 0 {
+		measurement = namePrefix + measurement
+	}
+	if len(nameSuffix) != 0 {
+		measurement = measurement + nameSuffix
+	}
+
+	// Apply plugin-wide tags if set
+	for k, v := range pluginTags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+	// Apply daemon-wide tags if set
+	for k, v := range daemonTags {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+
+	// Apply the metric filter(s)
+	if applyFilter {
+		if ok := filter.Apply(measurement, fields, tags); !ok {
+			return nil
+		}
 	}
 
 	for k, v := range tags {
 		if strings.HasSuffix(k, `\`) {
-			log.Printf("DEBUG: Measurement [%s] tag [%s] ends with a backslash, skipping", measurement, k)
+			log.Printf("D! Measurement [%s] tag [%s] ends with a backslash, skipping", measurement, k)
 			delete(tags, k)
 			continue
 		} else if strings.HasSuffix(v, `\`) {
-			log.Printf("DEBUG: Measurement [%s] tag [%s] has a value ending with a backslash, skipping", measurement, k)
+			log.Printf("D! Measurement [%s] tag [%s] has a value ending with a backslash, skipping", measurement, k)
 			delete(tags, k)
 			continue
 		}
@@ -49,7 +92,7 @@ func makemetric(
 
 	for k, v := range fields {
 		if strings.HasSuffix(k, `\`) {
-			log.Printf("DEBUG: Measurement [%s] field [%s] ends with a backslash, skipping", measurement, k)
+			log.Printf("D! Measurement [%s] field [%s] ends with a backslash, skipping", measurement, k)
 			delete(fields, k)
 			continue
 		}
@@ -97,7 +140,7 @@ func makemetric(
 		case float64:
 			// NaNs are invalid values in influxdb, skip measurement
 			if math.IsNaN(val) || math.IsInf(val, 0) {
-				log.Printf("DEBUG: Measurement [%s] field [%s] has a NaN or Inf field, skipping", measurement, k)
+				log.Printf("D! Measurement [%s] field [%s] has a NaN or Inf field, skipping", measurement, k)
 				delete(fields, k)
 				continue
 			}
@@ -110,7 +153,7 @@ func makemetric(
 
 	m, err := metric.New(measurement, tags, fields, t, mType)
 	if err != nil {
-		log.Printf("Error adding point [%s]: %s\n", measurement, err.Error())
+		log.Printf("E! Error adding point [%s]: %s\n", measurement, err.Error())
 		return nil
 	}
 
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+)
+
+func TestMakeMetricTags(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       map[string]string
+		pluginTags map[string]string
+		daemonTags map[string]string
+		expected   map[string]string
+	}{
+		{
+			name:     "no tags",
+			expected: map[string]string{},
+		},
+		{
+			name:       "plugin and daemon tags added",
+			tags:       map[string]string{"cpu": "cpu0"},
+			pluginTags: map[string]string{"dc": "a"},
+			daemonTags: map[string]string{"host": "h"},
+			expected:   map[string]string{"cpu": "cpu0", "dc": "a", "host": "h"},
+		},
+		{
+			name:       "metric tags take precedence",
+			tags:       map[string]string{"dc": "metric"},
+			pluginTags: map[string]string{"dc": "plugin", "rack": "plugin"},
+			daemonTags: map[string]string{"dc": "daemon", "rack": "daemon", "host": "daemon"},
+			expected:   map[string]string{"dc": "metric", "rack": "plugin", "host": "daemon"},
+		},
+		{
+			name:     "backslash dropped",
+			tags:     map[string]string{`a\`: "v", "b": `v\`, "c": "v"},
+			expected: map[string]string{"c": "v"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before map[string]string
+			if tt.tags != nil {
+				before = make(map[string]string, len(tt.tags))
+				for k, v := range tt.tags {
+					before[k] = v
+				}
+			}
+
+			m := makemetric("m", map[string]interface{}{"v": 1}, tt.tags, "", "", "",
+				tt.pluginTags, tt.daemonTags, Filter{}, true, asgard.Untyped, time.Unix(0, 0))
+			if m == nil {
+				t.Fatal("expected a metric")
+			}
+			if !reflect.DeepEqual(m.Tags(), tt.expected) {
+				t.Errorf("expected tags %v, got %v", tt.expected, m.Tags())
+			}
+			if !reflect.DeepEqual(tt.tags, before) {
+				t.Errorf("expected the tags of the caller to be left untouched, got %v", tt.tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/selfstat"
+	"github.com/anabiozz/asgard/metric"
+)
+
+// RunningAggregator is a configured aggregator instance. Metrics are added
+// to the period they are timestamped in, the agent pushes the period once it
+// ended and delay passed.
+type RunningAggregator struct {
+	Aggregator asgard.Aggregator
+	Config     *AggregatorConfig
+
+	log    *Logger
+	errors errorStats
+
+	// mu guards the aggregator and its period
+	mu          sync.Mutex
+	periodStart time.Time
+	periodEnd   time.Time
+	// pending are the metrics of the next period added before the current
+	// one was pushed
+	pending []asgard.Metric
+
+	statTags       map[string]string
+	MetricsPushed  selfstat.Stat
+	MetricsDropped selfstat.Stat
+}
+
+// AggregatorConfig containing the name, period and filter of an aggregator
+type AggregatorConfig struct {
+	Name  string
+	Alias string
+	// Instance numbers the instances of the plugin without an alias, in
+	// config order. It tells their stats apart.
+	Instance int
+
+	// DropOriginal keeps the metrics the aggregator takes from the outputs
+	DropOriginal bool
+	// Period is the length of the periods aggregated
+	Period time.Duration
+	// Delay is how long the agent waits for late metrics after a period
+	// ended before it is pushed
+	Delay time.Duration
+	// Grace accepts metrics up to Grace older than the current period into
+	// it, older metrics are dropped
+	Grace time.Duration
+
+	NameOverride      string
+	MeasurementPrefix string
+	MeasurementSuffix string
+	Tags              map[string]string
+	// Filter selects the metrics added to the aggregator
+	Filter Filter
+
+	// Checksum identifies the settings the aggregator was created from,
+	// aggregators with the same checksum keep running, with the metrics of
+	// their current period, when the config is reloaded
+	Checksum string
+}
+
+// NewRunningAggregator ...
+func NewRunningAggregator(aggregator asgard.Aggregator, config *AggregatorConfig) *RunningAggregator {
+	ra := &RunningAggregator{
+		Aggregator: aggregator,
+		Config:     config,
+	}
+	ra.log = NewLogger(ra.Name())
+	SetLoggerOnPlugin(aggregator, ra.log)
+
+	ra.statTags = statTags("aggregator", config.Name, config.Alias, config.Instance)
+	ra.MetricsPushed = selfstat.Register("internal_aggregate", "metrics_pushed", ra.statTags)
+	ra.MetricsDropped = selfstat.Register("internal_aggregate", "metrics_dropped", ra.statTags)
+	return ra
+}
+
+// UnregisterStats unregisters the stats of the aggregator instance, once it
+// was stopped or discarded
+func (ra *RunningAggregator) UnregisterStats() {
+	selfstat.Unregister("internal_aggregate", "metrics_pushed", ra.statTags)
+	selfstat.Unregister("internal_aggregate", "metrics_dropped", ra.statTags)
+}
+
+// Name returns the name of the aggregator instance, including its alias when
+// one is configured, ie "aggregators.basicstats::cpu"
+func (ra *RunningAggregator) Name() string {
+	if ra.Config.Alias != "" {
+		return "aggregators." + ra.Config.Name + "::" + ra.Config.Alias
+	}
+	return "aggregators." + ra.Config.Name
+}
+
+// Log returns the logger of the aggregator instance
+func (ra *RunningAggregator) Log() asgard.Logger {
+	return ra.log
+}
+
+// Period returns the bounds of the current period
+func (ra *RunningAggregator) Period() (start, end time.Time) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	return ra.periodStart, ra.periodEnd
+}
+
+// StartPeriod starts a new period, the metrics of the period that were added
+// before it started are added to the aggregator
+func (ra *RunningAggregator) StartPeriod(start, end time.Time) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.periodStart, ra.periodEnd = start, end
+
+	pending := ra.pending
+	ra.pending = nil
+	for _, m := range pending {
+		ra.add(m)
+	}
+}
+
+// Add adds a metric selected by the filter to the aggregator. It returns
+// true when the metric must not be written to the outputs, ie the metric
+// was selected and drop_original is set.
+func (ra *RunningAggregator) Add(m asgard.Metric) bool {
+	if ra.Config.Filter.IsActive() {
+		name := m.Name()
+		tags := m.Tags()
+		fields := m.Fields()
+		t := m.Time()
+		if ok := ra.Config.Filter.Apply(name, fields, tags); !ok {
+			return false
+		}
+		// error is not possible if creating from another metric, so ignore.
+		m, _ = metric.New(name, tags, fields, t, m.Type())
+	}
+
+	ra.mu.Lock()
+	ra.add(m)
+	ra.mu.Unlock()
+	return ra.Config.DropOriginal
+}
+
+// add adds m to the current period, or keeps it for the next one. Metrics
+// older than the grace or newer than the next period are dropped. The caller
+// must hold ra.mu.
+func (ra *RunningAggregator) add(m asgard.Metric) {
+	t := m.Time()
+	switch {
+	case t.Before(ra.periodStart.Add(-ra.Config.Grace)):
+		ra.MetricsDropped.Incr(1)
+	case t.Before(ra.periodEnd):
+		ra.Aggregator.Add(m)
+	case t.Before(ra.periodEnd.Add(ra.Config.Period)):
+		ra.pending = append(ra.pending, m)
+	default:
+		ra.MetricsDropped.Incr(1)
+	}
+}
+
+// Push pushes the aggregated metrics of the current period to acc and
+// resets the aggregator. acc must be an accumulator of ra, the metrics are
+// timestamped with the start of the period.
+func (ra *RunningAggregator) Push(acc asgard.Accumulator) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.Aggregator.Push(acc)
+	ra.Aggregator.Reset()
+}
+
+// MakeMetric makes the metrics pushed by the aggregator, they are stamped
+// with the start of the period. It is only called while the aggregator is
+// pushed.
+func (ra *RunningAggregator) MakeMetric(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	mType asgard.ValueType,
+	t time.Time) asgard.Metric {
+
+	m := makemetric(
+		measurement,
+		fields,
+		tags,
+		ra.Config.NameOverride,
+		ra.Config.MeasurementPrefix,
+		ra.Config.MeasurementSuffix,
+		ra.Config.Tags,
+		nil,
+		ra.Config.Filter,
+		false,
+		mType,
+		ra.periodStart,
+	)
+	if m != nil {
+		ra.MetricsPushed.Incr(1)
+	}
+	return m
+}
+
+// LogError logs err with the name of the aggregator instance. Logging is
+// rate-limited, errors beyond the limit are only counted.
+func (ra *RunningAggregator) LogError(err error) {
+	ok, suppressed := ra.errors.add(err, time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		ra.log.Errorf("Error in plugin: %s (%d similar errors suppressed)", err, suppressed)
+		return
+	}
+	ra.log.Errorf("Error in plugin: %s", err)
+}
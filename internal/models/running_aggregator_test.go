@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/metric"
+)
+
+// recordAggregator records the names of the metrics added since the last
+// reset and pushes their count
+type recordAggregator struct {
+	added []string
+}
+
+func (*recordAggregator) SampleConfig() string { return "" }
+func (*recordAggregator) Description() string  { return "" }
+func (a *recordAggregator) Add(m asgard.Metric) {
+	a.added = append(a.added, m.Name())
+}
+func (a *recordAggregator) Push(acc asgard.Accumulator) {
+	acc.AddFields("count", map[string]interface{}{"count": len(a.added)}, nil)
+}
+func (a *recordAggregator) Reset() {
+	a.added = nil
+}
+
+// pushAccumulator keeps the metrics made by the aggregator pushed
+type pushAccumulator struct {
+	ra      *RunningAggregator
+	metrics []asgard.Metric
+}
+
+func (a *pushAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if m := a.ra.MakeMetric(measurement, fields, tags, asgard.Untyped, time.Time{}); m != nil {
+		a.metrics = append(a.metrics, m)
+	}
+}
+func (a *pushAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *pushAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *pushAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *pushAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (*pushAccumulator) SetPrecision(precision, interval time.Duration) {}
+func (*pushAccumulator) AddError(err error)                             {}
+
+func TestRunningAggregatorAdd(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	period := 10 * time.Second
+
+	tests := []struct {
+		name   string
+		config AggregatorConfig
+		// offsets are the times of the metrics added, relative to the start
+		// of the period
+		offsets []time.Duration
+		// added are the metrics added to the current period, pending those
+		// added to the next one
+		added   []string
+		pending []string
+		dropped int64
+		// dropOriginal are the results of Add, false when not given
+		dropOriginal []bool
+	}{
+		{
+			name:    "current period",
+			offsets: []time.Duration{0, 5 * time.Second, period - time.Nanosecond},
+			added:   []string{"m0", "m1", "m2"},
+		},
+		{
+			name:    "next period",
+			offsets: []time.Duration{period, 2*period - time.Nanosecond},
+			pending: []string{"m0", "m1"},
+		},
+		{
+			name:    "too old or too new",
+			offsets: []time.Duration{-time.Nanosecond, 2 * period},
+			dropped: 2,
+		},
+		{
+			name:    "grace",
+			config:  AggregatorConfig{Grace: 5 * time.Second},
+			offsets: []time.Duration{-5 * time.Second, -5*time.Second - time.Nanosecond},
+			added:   []string{"m0"},
+			dropped: 1,
+		},
+		{
+			name:         "drop original",
+			config:       AggregatorConfig{DropOriginal: true},
+			offsets:      []time.Duration{0},
+			added:        []string{"m0"},
+			dropOriginal: []bool{true},
+		},
+		{
+			name:         "filtered",
+			config:       AggregatorConfig{DropOriginal: true, Filter: Filter{NamePass: []string{"m1"}}},
+			offsets:      []time.Duration{0, 0},
+			added:        []string{"m1"},
+			dropOriginal: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Name = "record"
+			config.Alias = tt.name
+			config.Period = period
+			if err := config.Filter.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			agg := &recordAggregator{}
+			ra := NewRunningAggregator(agg, &config)
+			defer ra.UnregisterStats()
+
+			ra.StartPeriod(start, start.Add(period))
+			for i, offset := range tt.offsets {
+				m, err := metric.New(fmt.Sprintf("m%d", i), nil, map[string]interface{}{"v": 1}, start.Add(offset))
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected := i < len(tt.dropOriginal) && tt.dropOriginal[i]
+				if dropOriginal := ra.Add(m); dropOriginal != expected {
+					t.Errorf("%s: expected drop original %v, got %v", m.Name(), expected, dropOriginal)
+				}
+			}
+
+			if strings.Join(agg.added, ",") != strings.Join(tt.added, ",") {
+				t.Errorf("expected %q added, got %q", tt.added, agg.added)
+			}
+			if dropped := ra.MetricsDropped.Get(); dropped != tt.dropped {
+				t.Errorf("expected %d dropped, got %d", tt.dropped, dropped)
+			}
+
+			// the pending metrics are added once the next period starts
+			agg.Reset()
+			ra.StartPeriod(start.Add(period), start.Add(2*period))
+			if strings.Join(agg.added, ",") != strings.Join(tt.pending, ",") {
+				t.Errorf("expected %q pending, got %q", tt.pending, agg.added)
+			}
+		})
+	}
+}
+
+func TestRunningAggregatorPush(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	config := &AggregatorConfig{
+		Name:              "record",
+		Period:            10 * time.Second,
+		MeasurementPrefix: "agg_",
+		Tags:              map[string]string{"dc": "a"},
+	}
+	agg := &recordAggregator{}
+	ra := NewRunningAggregator(agg, config)
+	defer ra.UnregisterStats()
+
+	ra.StartPeriod(start, start.Add(config.Period))
+	m, err := metric.New("m", nil, map[string]interface{}{"v": 1}, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra.Add(m)
+
+	acc := &pushAccumulator{ra: ra}
+	ra.Push(acc)
+	if len(acc.metrics) != 1 {
+		t.Fatalf("expected 1 metric pushed, got %d", len(acc.metrics))
+	}
+	pushed := acc.metrics[0]
+	if pushed.Name() != "agg_count" || pushed.Tags()["dc"] != "a" || !pushed.Time().Equal(start) {
+		t.Errorf("expected agg_count,dc=a stamped with the start of the period, got %s", pushed)
+	}
+	if len(agg.added) != 0 {
+		t.Errorf("expected the aggregator to be reset, got %q", agg.added)
+	}
+	if pushedCount := ra.MetricsPushed.Get(); pushedCount != 1 {
+		t.Errorf("expected 1 metric pushed, got %d", pushedCount)
+	}
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
-	"fmt"
+	"context"
 	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/selfstat"
+	"sync"
 	"time"
 )
 
@@ -10,22 +12,50 @@ import (
 type RunningInput struct {
 	Input       asgard.Input
 	Config      *InputConfig
-	trace       bool
 	defaultTags map[string]string
+
+	log    *Logger
+	errors errorStats
+
+	mu         sync.Mutex
+	lastGather time.Time
+	gatherTime time.Duration
+
+	statTags map[string]string
+
+	MetricsGathered selfstat.Stat
+	GatherTime      selfstat.Stat
+	GatherErrors    selfstat.Stat
 }
 
 // InputConfig containing a name, interval, and filter
 type InputConfig struct {
-	Name              string
+	Name  string
+	Alias string
+	// Instance numbers the instances of the plugin without an alias, in
+	// config order. It tells their stats apart.
+	Instance int
+
 	NameOverride      string
 	MeasurementPrefix string
 	MeasurementSuffix string
 	Tags              map[string]string
+	Filter            Filter
 	Interval          time.Duration
+	// Timeout limits how long a gather may take, the interval when zero
+	Timeout time.Duration
+
+	// Checksum identifies the settings the input was created from, inputs
+	// with the same checksum are kept running when the config is reloaded
+	Checksum string
 }
 
-// Name ...
+// Name returns the name of the input instance, including its alias when one
+// is configured, ie "inputs.influxdb::cluster-a"
 func (r *RunningInput) Name() string {
+	if r.Config.Alias != "" {
+		return "inputs." + r.Config.Name + "::" + r.Config.Alias
+	}
 	return "inputs." + r.Config.Name
 }
 
@@ -38,18 +68,119 @@ func (r *RunningInput) MakeMetric(
 	mType asgard.ValueType,
 	t time.Time) asgard.Metric {
 
-	m := makemetric(measurement, fields, tags, mType, t)
+	m := makemetric(
+		measurement,
+		fields,
+		tags,
+		r.Config.NameOverride,
+		r.Config.MeasurementPrefix,
+		r.Config.MeasurementSuffix,
+		r.Config.Tags,
+		r.defaultTags,
+		r.Config.Filter,
+		true,
+		mType,
+		t,
+	)
+	if m != nil {
+		r.MetricsGathered.Incr(1)
+	}
+	return m
+}
 
-	if r.trace && m != nil {
-		fmt.Print("> " + m.String())
+// Gather gathers the input once, recording how long it took. Inputs
+// implementing asgard.ContextInput are gathered with ctx.
+func (r *RunningInput) Gather(ctx context.Context, acc asgard.Accumulator) error {
+	start := time.Now()
+	var err error
+	if input, ok := r.Input.(asgard.ContextInput); ok {
+		err = input.GatherContext(ctx, acc)
+	} else {
+		err = r.Input.Gather(acc)
 	}
+	elapsed := time.Since(start)
+	r.GatherTime.Incr(elapsed.Nanoseconds())
 
-	return m
+	r.mu.Lock()
+	r.lastGather = start
+	r.gatherTime = elapsed
+	r.mu.Unlock()
+	return err
+}
+
+// InputStatus is the state of an input instance
+type InputStatus struct {
+	Name string
+	// LastGather is when the last gather started, zero before the first one
+	LastGather time.Time
+	// GatherTime is how long the last gather took
+	GatherTime time.Duration
+	Errors     ErrorCount
+}
+
+// Status returns the state of the input instance
+func (r *RunningInput) Status() InputStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return InputStatus{
+		Name:       r.Name(),
+		LastGather: r.lastGather,
+		GatherTime: r.gatherTime,
+		Errors:     r.errors.get(),
+	}
+}
+
+// SetDefaultTags sets the daemon-wide tags, applied to every metric after the
+// tags of the input itself.
+func (r *RunningInput) SetDefaultTags(tags map[string]string) {
+	r.defaultTags = tags
 }
 
 // NewRunningInput ...
-func NewRunningInput(input asgard.Input) *RunningInput {
-	return &RunningInput{
-		Input: input,
+func NewRunningInput(input asgard.Input, config *InputConfig) *RunningInput {
+	r := &RunningInput{
+		Input:  input,
+		Config: config,
+	}
+	r.log = NewLogger(r.Name())
+	SetLoggerOnPlugin(input, r.log)
+
+	r.statTags = statTags("input", config.Name, config.Alias, config.Instance)
+	r.MetricsGathered = selfstat.Register("internal_gather", "metrics_gathered", r.statTags)
+	r.GatherTime = selfstat.RegisterTiming("internal_gather", "gather_time_ns", r.statTags)
+	r.GatherErrors = selfstat.Register("internal_gather", "errors", r.statTags)
+	return r
+}
+
+// UnregisterStats unregisters the stats of the input instance, once it was
+// stopped or discarded
+func (r *RunningInput) UnregisterStats() {
+	selfstat.Unregister("internal_gather", "metrics_gathered", r.statTags)
+	selfstat.Unregister("internal_gather", "gather_time_ns", r.statTags)
+	selfstat.Unregister("internal_gather", "errors", r.statTags)
+}
+
+// Log returns the logger of the input instance
+func (r *RunningInput) Log() asgard.Logger {
+	return r.log
+}
+
+// LogError counts err and logs it with the name of the input instance.
+// Logging is rate-limited, errors beyond the limit are only counted.
+func (r *RunningInput) LogError(err error) {
+	r.GatherErrors.Incr(1)
+	ok, suppressed := r.errors.add(err, time.Now())
+	if !ok {
+		return
 	}
+	if suppressed > 0 {
+		r.log.Errorf("Error in plugin: %s (%d similar errors suppressed)", err, suppressed)
+		return
+	}
+	r.log.Errorf("Error in plugin: %s", err)
+}
+
+// Errors returns the errors counted since the input instance was started
+func (r *RunningInput) Errors() ErrorCount {
+	return r.errors.get()
 }
@@ -1,13 +1,13 @@
 package models
 
 import (
-	"log"
 	"sync"
 	"time"
 
 	"github.com/anabiozz/asgard"
 	"github.com/anabiozz/asgard/internal/buffer"
-	//"heimdall_project/asgard/metric"
+	"github.com/anabiozz/asgard/internal/selfstat"
+	"github.com/anabiozz/asgard/metric"
 )
 
 const (
@@ -29,12 +29,34 @@ type RunningOutput struct {
 	metrics     *buffer.Buffer
 	failMetrics *buffer.Buffer
 
+	log *Logger
+
+	statTags       map[string]string
+	MetricsWritten selfstat.Stat
+	MetricsDropped selfstat.Stat
+	BufferSize     selfstat.Stat
+	BufferLimit    selfstat.Stat
+	WriteTime      selfstat.Stat
+
+	// statusMu guards the result of the last writes
+	statusMu     sync.Mutex
+	lastWrite    time.Time
+	failingSince time.Time
+	lastError    error
+	paused       bool
+
 	// Guards against concurrent calls to the Output as described in #3009
 	sync.Mutex
 }
 
 // NewRunningOutput ...
-func NewRunningOutput(name string, output asgard.Output, batchSize int, bufferLimit int) *RunningOutput {
+func NewRunningOutput(
+	name string,
+	output asgard.Output,
+	config *OutputConfig,
+	batchSize int,
+	bufferLimit int,
+) *RunningOutput {
 	if bufferLimit == 0 {
 		bufferLimit = DEFAULT_METRIC_BUFFER_LIMIT
 	}
@@ -42,7 +64,9 @@ func NewRunningOutput(name string, output asgard.Output, batchSize int, bufferLi
 		batchSize = DEFAULT_METRIC_BATCH_SIZE
 	}
 
-	config := &OutputConfig{}
+	if config.Alias != "" {
+		name += "::" + config.Alias
+	}
 
 	ro := &RunningOutput{
 		Name:              name,
@@ -52,13 +76,44 @@ func NewRunningOutput(name string, output asgard.Output, batchSize int, bufferLi
 		failMetrics:       buffer.NewBuffer(bufferLimit),
 		MetricBufferLimit: bufferLimit,
 		MetricBatchSize:   batchSize,
+		log:               NewLogger("outputs." + name),
 	}
+	SetLoggerOnPlugin(output, ro.log)
+
+	ro.statTags = statTags("output", config.Name, config.Alias, config.Instance)
+	ro.MetricsWritten = selfstat.Register("internal_write", "metrics_written", ro.statTags)
+	ro.MetricsDropped = selfstat.Register("internal_write", "metrics_dropped", ro.statTags)
+	ro.BufferSize = selfstat.Register("internal_write", "buffer_size", ro.statTags)
+	ro.BufferLimit = selfstat.Register("internal_write", "buffer_limit", ro.statTags)
+	ro.WriteTime = selfstat.RegisterTiming("internal_write", "write_time_ns", ro.statTags)
+	ro.BufferLimit.Set(int64(bufferLimit))
 	return ro
 }
 
+// UnregisterStats unregisters the stats of the output, once it was closed or
+// discarded
+func (ro *RunningOutput) UnregisterStats() {
+	selfstat.Unregister("internal_write", "metrics_written", ro.statTags)
+	selfstat.Unregister("internal_write", "metrics_dropped", ro.statTags)
+	selfstat.Unregister("internal_write", "buffer_size", ro.statTags)
+	selfstat.Unregister("internal_write", "buffer_limit", ro.statTags)
+	selfstat.Unregister("internal_write", "write_time_ns", ro.statTags)
+}
+
 // OutputConfig containing name and filter
 type OutputConfig struct {
-	Name string
+	Name  string
+	Alias string
+	// Instance numbers the instances of the plugin without an alias, in
+	// config order. It tells their stats apart.
+	Instance int
+
+	Filter Filter
+
+	// Checksum identifies the settings the output was created from, outputs
+	// with the same checksum keep running, with their buffered metrics, when
+	// the config is reloaded
+	Checksum string
 }
 
 // AddMetric adds a metric to the output. This function can also write cached
@@ -67,20 +122,41 @@ func (ro *RunningOutput) AddMetric(m asgard.Metric) {
 	if m == nil {
 		return
 	}
-	ro.metrics.Add(m)
+	// Filter any name/field/tag parameters before adding metric
+	if ro.Config.Filter.IsActive() {
+		// In order to filter out tags and fields, we need to create a new
+		// metric, since metrics are immutable once created.
+		name := m.Name()
+		tags := m.Tags()
+		fields := m.Fields()
+		t := m.Time()
+		if ok := ro.Config.Filter.Apply(name, fields, tags); !ok {
+			return
+		}
+		// error is not possible if creating from another metric, so ignore.
+		m, _ = metric.New(name, tags, fields, t, m.Type())
+	}
+	ro.MetricsDropped.Incr(int64(ro.metrics.Add(m)))
 	if ro.metrics.Len() == ro.MetricBatchSize {
 		batch := ro.metrics.Batch(ro.MetricBatchSize)
-		err := ro.write(batch)
-		if err != nil {
-			ro.failMetrics.Add(batch...)
+		if ro.Paused() {
+			ro.addFailed(batch)
+		} else if err := ro.write(batch); err != nil {
+			ro.addFailed(batch)
 		}
 	}
+	ro.BufferSize.Set(int64(ro.metrics.Len() + ro.failMetrics.Len()))
 }
 
-// Write writes all cached points to this output.
+// Write writes all cached points to this output. A paused output keeps them
+// buffered.
 func (ro *RunningOutput) Write() error {
 	nFails, nMetrics := ro.failMetrics.Len(), ro.metrics.Len()
-	log.Printf("DEBUG: Output [%s] buffer fullness: %d / %d metrics. ", ro.Name, nFails+nMetrics, ro.MetricBufferLimit)
+	ro.log.Debugf("Buffer fullness: %d / %d metrics", nFails+nMetrics, ro.MetricBufferLimit)
+	if ro.Paused() {
+		ro.log.Debugf("Output is paused, not writing")
+		return nil
+	}
 	var err error
 	if !ro.failMetrics.IsEmpty() {
 		// how many batches of failed writes we need to write.
@@ -101,7 +177,7 @@ func (ro *RunningOutput) Write() error {
 				err = ro.write(batch)
 			}
 			if err != nil {
-				ro.failMetrics.Add(batch...)
+				ro.addFailed(batch)
 			}
 		}
 	}
@@ -114,10 +190,16 @@ func (ro *RunningOutput) Write() error {
 	}
 
 	if err != nil {
-		ro.failMetrics.Add(batch...)
-		return err
+		ro.addFailed(batch)
 	}
-	return nil
+	ro.BufferSize.Set(int64(ro.metrics.Len() + ro.failMetrics.Len()))
+	return err
+}
+
+// addFailed keeps a batch that could not be written for the next write,
+// counting the metrics dropped once the buffer limit is reached
+func (ro *RunningOutput) addFailed(batch []asgard.Metric) {
+	ro.MetricsDropped.Incr(int64(ro.failMetrics.Add(batch...)))
 }
 
 func (ro *RunningOutput) write(metrics []asgard.Metric) error {
@@ -132,8 +214,81 @@ func (ro *RunningOutput) write(metrics []asgard.Metric) error {
 	start := time.Now()
 	err := ro.Output.Write(metrics)
 	elapsed := time.Since(start)
+	ro.WriteTime.Incr(elapsed.Nanoseconds())
+
+	ro.statusMu.Lock()
+	if err == nil {
+		ro.lastWrite = start
+		ro.failingSince = time.Time{}
+		ro.lastError = nil
+	} else {
+		if ro.failingSince.IsZero() {
+			ro.failingSince = start
+		}
+		ro.lastError = err
+	}
+	ro.statusMu.Unlock()
+
 	if err == nil {
-		log.Printf("DEBUG: Output [%s] wrote batch of %d metrics in %s\n", ro.Name, nMetrics, elapsed)
+		ro.MetricsWritten.Incr(int64(nMetrics))
+		ro.log.Debugf("Wrote batch of %d metrics in %s", nMetrics, elapsed)
 	}
 	return err
 }
+
+// Pause stops writing to the output, metrics are buffered meanwhile up to
+// the buffer limit
+func (ro *RunningOutput) Pause() {
+	ro.statusMu.Lock()
+	ro.paused = true
+	ro.statusMu.Unlock()
+}
+
+// Resume writes to the output again after Pause
+func (ro *RunningOutput) Resume() {
+	ro.statusMu.Lock()
+	ro.paused = false
+	ro.statusMu.Unlock()
+}
+
+// Paused reports whether the output is paused
+func (ro *RunningOutput) Paused() bool {
+	ro.statusMu.Lock()
+	defer ro.statusMu.Unlock()
+	return ro.paused
+}
+
+// OutputStatus is the state of an output instance
+type OutputStatus struct {
+	Name string
+	// LastWrite is when the last successful write started, zero before
+	// the first one
+	LastWrite time.Time
+	// FailingSince is when the first of the writes that failed since the
+	// last successful one started, zero when the last write succeeded
+	FailingSince time.Time
+	LastError    error
+	// BufferSize is the number of buffered metrics, FailedSize the number of
+	// them held back by failed writes or while the output was paused
+	BufferSize  int
+	FailedSize  int
+	BufferLimit int
+	Paused      bool
+}
+
+// Status returns the state of the output instance
+func (ro *RunningOutput) Status() OutputStatus {
+	ro.statusMu.Lock()
+	defer ro.statusMu.Unlock()
+	failed := ro.failMetrics.Len()
+	return OutputStatus{
+		Name:         "outputs." + ro.Name,
+		LastWrite:    ro.lastWrite,
+		FailingSince: ro.failingSince,
+		LastError:    ro.lastError,
+		BufferSize:   ro.metrics.Len() + failed,
+		FailedSize:   failed,
+		BufferLimit:  ro.MetricBufferLimit,
+		Paused:       ro.paused,
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"github.com/anabiozz/asgard"
+)
+
+// RunningProcessor is a configured processor instance
+type RunningProcessor struct {
+	Processor asgard.Processor
+	Config    *ProcessorConfig
+
+	log *Logger
+}
+
+// ProcessorConfig containing the name, order and filter of a processor
+type ProcessorConfig struct {
+	Name  string
+	Alias string
+	// Order places the processor among the others, processors of the same
+	// order run in the order of their tables
+	Order int64
+	// Filter selects the metrics the processor is applied to, the others
+	// are passed on untouched
+	Filter Filter
+
+	// Checksum identifies the settings the processor was created from
+	Checksum string
+}
+
+// NewRunningProcessor ...
+func NewRunningProcessor(processor asgard.Processor, config *ProcessorConfig) *RunningProcessor {
+	rp := &RunningProcessor{
+		Processor: processor,
+		Config:    config,
+	}
+	rp.log = NewLogger(rp.Name())
+	SetLoggerOnPlugin(processor, rp.log)
+	return rp
+}
+
+// Name returns the name of the processor instance, including its alias when
+// one is configured, ie "processors.rename::cpu"
+func (rp *RunningProcessor) Name() string {
+	if rp.Config.Alias != "" {
+		return "processors." + rp.Config.Name + "::" + rp.Config.Alias
+	}
+	return "processors." + rp.Config.Name
+}
+
+// Apply applies the processor to the metrics selected by its filter, the
+// other metrics are returned unchanged. The metrics keep their order, every
+// run of consecutive selected metrics is applied at once.
+func (rp *RunningProcessor) Apply(in ...asgard.Metric) []asgard.Metric {
+	if !rp.Config.Filter.IsActive() {
+		return rp.Processor.Apply(in...)
+	}
+
+	out := make([]asgard.Metric, 0, len(in))
+	for start := 0; start < len(in); {
+		end := start
+		for end < len(in) && rp.Config.Filter.Select(in[end].Name(), in[end].Tags()) {
+			end++
+		}
+		if end == start {
+			out = append(out, in[start])
+			start++
+			continue
+		}
+		// the run is capped, so a processor appending to it doesn't
+		// overwrite the metrics following it
+		out = append(out, rp.Processor.Apply(in[start:end:end]...)...)
+		start = end
+	}
+	return out
+}
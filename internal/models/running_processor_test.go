@@ -0,0 +1,107 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/metric"
+)
+
+// suffixProcessor appends "_p" to the name of the metrics and, with
+// duplicate, appends a copy of every metric named "<name>_copy"
+type suffixProcessor struct {
+	duplicate bool
+	calls     int
+}
+
+func (*suffixProcessor) SampleConfig() string { return "" }
+func (*suffixProcessor) Description() string  { return "" }
+func (p *suffixProcessor) Apply(in ...asgard.Metric) []asgard.Metric {
+	p.calls++
+	for _, m := range in {
+		m.SetName(m.Name() + "_p")
+	}
+	if p.duplicate {
+		for _, m := range in {
+			c := m.Copy()
+			c.SetName(m.Name() + "_copy")
+			in = append(in, c)
+		}
+	}
+	return in
+}
+
+func newMetric(t *testing.T, name string) asgard.Metric {
+	m, err := metric.New(name, nil, map[string]interface{}{"v": 1}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRunningProcessorApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    Filter
+		duplicate bool
+		in        []string
+		expected  []string
+		// calls is the number of times the processor is applied
+		calls int
+	}{
+		{
+			name:     "no filter",
+			in:       []string{"a", "b"},
+			expected: []string{"a_p", "b_p"},
+			calls:    1,
+		},
+		{
+			name:     "order kept",
+			filter:   Filter{NamePass: []string{"cpu*"}},
+			in:       []string{"mem", "cpu1", "cpu2", "disk", "cpu3"},
+			expected: []string{"mem", "cpu1_p", "cpu2_p", "disk", "cpu3_p"},
+			calls:    2,
+		},
+		{
+			name:     "nothing selected",
+			filter:   Filter{NameDrop: []string{"*"}},
+			in:       []string{"a", "b"},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:      "metrics added",
+			filter:    Filter{NamePass: []string{"cpu*"}},
+			duplicate: true,
+			in:        []string{"cpu1", "mem", "cpu2", "cpu3", "disk"},
+			expected:  []string{"cpu1_p", "cpu1_p_copy", "mem", "cpu2_p", "cpu3_p", "cpu2_p_copy", "cpu3_p_copy", "disk"},
+			calls:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			p := &suffixProcessor{duplicate: tt.duplicate}
+			rp := NewRunningProcessor(p, &ProcessorConfig{Name: "suffix", Filter: tt.filter})
+
+			var in []asgard.Metric
+			for _, name := range tt.in {
+				in = append(in, newMetric(t, name))
+			}
+			var names []string
+			for _, m := range rp.Apply(in...) {
+				names = append(names, m.Name())
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %q, got %q", tt.expected, names)
+			}
+			if p.calls != tt.calls {
+				t.Errorf("expected %d calls, got %d", tt.calls, p.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+import "strconv"
+
+// statTags returns the tags of the stats of a plugin instance, the plugin
+// name tagged with kind and either its alias or its instance number
+func statTags(kind, name, alias string, instance int) map[string]string {
+	tags := map[string]string{kind: name}
+	if alias != "" {
+		tags["alias"] = alias
+	} else {
+		tags["instance"] = strconv.Itoa(instance)
+	}
+	return tags
+}
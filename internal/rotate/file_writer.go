@@ -0,0 +1,103 @@
+// Package rotate provides a log file writer that rotates the file once it
+// reaches a maximum size.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileWriter appends to a file. Once a write would grow the file beyond
+// MaxSize the file is rotated: path is renamed to path.1, path.1 to path.2
+// and so on, keeping at most MaxArchives old files.
+type FileWriter struct {
+	path        string
+	maxSize     int64
+	maxArchives int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileWriter opens path for appending. A maxSize of 0 never rotates.
+func NewFileWriter(path string, maxSize int64, maxArchives int) (*FileWriter, error) {
+	w := &FileWriter{
+		path:        path,
+		maxSize:     maxSize,
+		maxArchives: maxArchives,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *FileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = fi.Size()
+	return nil
+}
+
+// Write writes p to the file, rotating it first when p doesn't fit anymore
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, fmt.Errorf("%s is closed", w.path)
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file out of the way and opens a new one
+func (w *FileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if w.maxArchives > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxArchives))
+		for i := w.maxArchives - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Close closes the file
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
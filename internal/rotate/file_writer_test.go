@@ -0,0 +1,128 @@
+package rotate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		maxArchives int
+		writes      []string
+		// expected are the contents of the log file followed by those of
+		// its archives
+		expected []string
+	}{
+		{
+			name:     "no rotation",
+			writes:   []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected: []string{"aaaa\nbbbb\ncccc\n"},
+		},
+		{
+			name:        "rotated",
+			maxSize:     10,
+			maxArchives: 5,
+			writes:      []string{"aaaa\n", "bbbb\n", "cccc\n"},
+			expected:    []string{"cccc\n", "aaaa\nbbbb\n"},
+		},
+		{
+			name:        "oldest archives removed",
+			maxSize:     5,
+			maxArchives: 2,
+			writes:      []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n"},
+			expected:    []string{"dddd\n", "cccc\n", "bbbb\n"},
+		},
+		{
+			name:     "no archives",
+			maxSize:  5,
+			writes:   []string{"aaaa\n", "bbbb\n"},
+			expected: []string{"bbbb\n"},
+		},
+		{
+			name:        "larger than max size",
+			maxSize:     5,
+			maxArchives: 1,
+			writes:      []string{"aaaaaaaaaa\n", "b\n"},
+			expected:    []string{"b\n", "aaaaaaaaaa\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "asgard-rotate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "asgard.log")
+
+			w, err := NewFileWriter(path, tt.maxSize, tt.maxArchives)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("closed")); err == nil {
+				t.Error("expected an error writing to a closed writer")
+			}
+
+			var contents []string
+			for i := 0; ; i++ {
+				name := path
+				if i > 0 {
+					name = fmt.Sprintf("%s.%d", path, i)
+				}
+				b, err := ioutil.ReadFile(name)
+				if os.IsNotExist(err) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				contents = append(contents, string(b))
+			}
+			if !reflect.DeepEqual(contents, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, contents)
+			}
+		})
+	}
+}
+
+func TestFileWriterAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "asgard.log")
+	if err := ioutil.WriteFile(path, []byte("aaaa\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the size of the existing file counts towards the max size
+	w, err := NewFileWriter(path, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("bbbb\n"))
+	w.Close()
+
+	for name, expected := range map[string]string{path: "bbbb\n", path + ".1": "aaaa\n"} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil || string(b) != expected {
+			t.Errorf("expected %q in %s, got %q, %v", expected, name, b, err)
+		}
+	}
+}
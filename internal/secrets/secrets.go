@@ -0,0 +1,110 @@
+// Package secrets resolves the @{<store id>:<key>} references plugins use
+// for credentials.
+package secrets
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/anabiozz/asgard"
+)
+
+// refRe matches a secret reference, ie @{local:influxdb_password}
+var refRe = regexp.MustCompile(`@\{([^:{}]+):([^{}]+)\}`)
+
+var (
+	mu     sync.RWMutex
+	stores = map[string]asgard.SecretStore{}
+)
+
+// SetStores replaces the secret stores references are resolved with
+func SetStores(s map[string]asgard.SecretStore) {
+	mu.Lock()
+	defer mu.Unlock()
+	stores = s
+}
+
+// Ref is a secret reference found in a string
+type Ref struct {
+	Store string
+	Key   string
+}
+
+// Refs returns the secret references in s
+func Refs(s string) []Ref {
+	var refs []Ref
+	for _, m := range refRe.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, Ref{Store: m[1], Key: m[2]})
+	}
+	return refs
+}
+
+// Secret is a plugin setting that may contain secret references. They are
+// only resolved by Get, when the plugin needs the value, so secrets never sit
+// in the decoded config. Printing a Secret doesn't reveal its value.
+type Secret struct {
+	raw string
+}
+
+// NewSecret returns a Secret for s
+func NewSecret(s string) Secret {
+	return Secret{raw: s}
+}
+
+// UnmarshalText keeps the setting as written in the config
+func (s *Secret) UnmarshalText(text []byte) error {
+	s.raw = string(text)
+	return nil
+}
+
+// Empty reports whether the setting is not set
+func (s Secret) Empty() bool {
+	return s.raw == ""
+}
+
+// Get returns the setting with every secret reference replaced by the secret
+// it names.
+func (s Secret) Get() (string, error) {
+	if !refRe.MatchString(s.raw) {
+		return s.raw, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	var err error
+	value := refRe.ReplaceAllStringFunc(s.raw, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := refRe.FindStringSubmatch(ref)
+		store, ok := stores[m[1]]
+		if !ok {
+			err = fmt.Errorf("unknown secret store %q", m[1])
+			return ""
+		}
+		secret, e := store.Get(m[2])
+		if e != nil {
+			err = fmt.Errorf("Error getting secret %s: %s", ref, e)
+			return ""
+		}
+		return string(secret)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// String hides the value, so a Secret can't end up in a log by accident
+func (s Secret) String() string {
+	if s.raw == "" {
+		return ""
+	}
+	return "<secret>"
+}
+
+// GoString hides the value from %#v too
+func (s Secret) GoString() string {
+	return s.String()
+}
@@ -0,0 +1,194 @@
+// Package selfstat keeps the statistics the agent collects about itself,
+// they are reported by the internal input.
+//
+// Stats are registered by measurement, field and tags. Registering the same
+// stat twice returns the existing one, so a plugin instance that is recreated
+// on reload keeps counting where the previous one stopped. A stat is removed
+// once it was unregistered as many times as it was registered.
+package selfstat
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/metric"
+)
+
+// Stat is a single statistic
+type Stat interface {
+	// Incr adds v to the stat, for a timing stat v is one sample
+	Incr(v int64)
+	// Set sets the stat to v
+	Set(v int64)
+	// Get returns the value of the stat
+	Get() int64
+}
+
+// counter is a Stat holding a plain value
+type counter struct {
+	v int64
+}
+
+func (c *counter) Incr(v int64) { atomic.AddInt64(&c.v, v) }
+func (c *counter) Set(v int64)  { atomic.StoreInt64(&c.v, v) }
+func (c *counter) Get() int64   { return atomic.LoadInt64(&c.v) }
+
+// timing is a Stat averaging the samples added since it was last read. When
+// no sample was added the previous average is kept.
+type timing struct {
+	mu    sync.Mutex
+	sum   int64
+	count int64
+	v     int64
+}
+
+func (t *timing) Incr(v int64) {
+	t.mu.Lock()
+	t.sum += v
+	t.count++
+	t.mu.Unlock()
+}
+
+func (t *timing) Set(v int64) {
+	t.mu.Lock()
+	t.sum, t.count, t.v = 0, 0, v
+	t.mu.Unlock()
+}
+
+func (t *timing) Get() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.count > 0 {
+		t.v = t.sum / t.count
+		t.sum, t.count = 0, 0
+	}
+	return t.v
+}
+
+// series is the stats of one measurement and set of tags
+type series struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]Stat
+	// refs counts the registrations of every field
+	refs map[string]int
+}
+
+var (
+	mu       sync.Mutex
+	registry = map[string]*series{}
+)
+
+// Register returns the counter stat of the given measurement, field and tags
+func Register(measurement, field string, tags map[string]string) Stat {
+	return register(measurement, field, tags, func() Stat { return &counter{} })
+}
+
+// RegisterTiming returns the timing stat of the given measurement, field and
+// tags. Its value is the average of the samples added between two reads.
+func RegisterTiming(measurement, field string, tags map[string]string) Stat {
+	return register(measurement, field, tags, func() Stat { return &timing{} })
+}
+
+func register(measurement, field string, tags map[string]string, newStat func() Stat) Stat {
+	mu.Lock()
+	defer mu.Unlock()
+
+	k := key(measurement, tags)
+	s, ok := registry[k]
+	if !ok {
+		t := make(map[string]string, len(tags))
+		for name, value := range tags {
+			t[name] = value
+		}
+		s = &series{measurement: measurement, tags: t, fields: map[string]Stat{}, refs: map[string]int{}}
+		registry[k] = s
+	}
+	stat, ok := s.fields[field]
+	if !ok {
+		stat = newStat()
+		s.fields[field] = stat
+	}
+	s.refs[field]++
+	return stat
+}
+
+// Unregister releases a registration of the stat of the given measurement,
+// field and tags. The stat is no longer reported once every registration was
+// released.
+func Unregister(measurement, field string, tags map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	k := key(measurement, tags)
+	s, ok := registry[k]
+	if !ok || s.refs[field] == 0 {
+		return
+	}
+	s.refs[field]--
+	if s.refs[field] > 0 {
+		return
+	}
+	delete(s.refs, field)
+	delete(s.fields, field)
+	if len(s.fields) == 0 {
+		delete(registry, k)
+	}
+}
+
+// key identifies the series of measurement and tags
+func key(measurement string, tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(measurement)
+	for _, name := range names {
+		b.WriteString(",")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(tags[name])
+	}
+	return b.String()
+}
+
+// Metrics returns a metric for every registered series, sorted by
+// measurement and tags
+func Metrics() []asgard.Metric {
+	mu.Lock()
+	keys := make([]string, 0, len(registry))
+	for k := range registry {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	all := make([]*series, len(keys))
+	for i, k := range keys {
+		all[i] = registry[k]
+	}
+	mu.Unlock()
+
+	now := time.Now()
+	metrics := make([]asgard.Metric, 0, len(all))
+	for _, s := range all {
+		mu.Lock()
+		fields := make(map[string]interface{}, len(s.fields))
+		for name, stat := range s.fields {
+			fields[name] = stat.Get()
+		}
+		mu.Unlock()
+
+		m, err := metric.New(s.measurement, s.tags, fields, now)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
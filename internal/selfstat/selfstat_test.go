@@ -0,0 +1,93 @@
+package selfstat
+
+import "testing"
+
+// registered tells whether a series of measurement is reported with the
+// given tags and field
+func registered(measurement, field string, tags map[string]string) bool {
+	for _, m := range Metrics() {
+		if m.Name() != measurement || len(m.Tags()) != len(tags) {
+			continue
+		}
+		match := true
+		for k, v := range tags {
+			match = match && m.Tags()[k] == v
+		}
+		if _, ok := m.Fields()[field]; match && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUnregister(t *testing.T) {
+	tags := map[string]string{"input": "test", "instance": "0"}
+	other := map[string]string{"input": "test", "instance": "1"}
+
+	steps := []struct {
+		name       string
+		register   map[string]string
+		unregister map[string]string
+		// incr is added to the stat registered or, when unregistering,
+		// to the stat of tags
+		incr int64
+		// registered tells whether the stat of tags is still reported, with
+		// the value expected
+		registered bool
+		value      int64
+	}{
+		{name: "register", register: tags, incr: 1, registered: true, value: 1},
+		{name: "register again", register: tags, incr: 1, registered: true, value: 2},
+		{name: "register other tags", register: other, incr: 5, registered: true, value: 2},
+		{name: "unregister one", unregister: tags, registered: true, value: 2},
+		{name: "unregister other tags", unregister: other, registered: true, value: 2},
+		{name: "unregister last", unregister: tags, registered: false},
+		{name: "unregister unknown", unregister: tags, registered: false},
+		{name: "register after unregister", register: tags, incr: 1, registered: true, value: 1},
+		{name: "cleanup", unregister: tags, registered: false},
+	}
+
+	for _, step := range steps {
+		if step.register != nil {
+			Register("test_unregister", "count", step.register).Incr(step.incr)
+		}
+		if step.unregister != nil {
+			Unregister("test_unregister", "count", step.unregister)
+		}
+		if r := registered("test_unregister", "count", tags); r != step.registered {
+			t.Fatalf("%s: expected registered %v, got %v", step.name, step.registered, r)
+		}
+		if step.registered {
+			if v := Register("test_unregister", "count", tags).Get(); v != step.value {
+				t.Errorf("%s: expected %d, got %d", step.name, step.value, v)
+			}
+			Unregister("test_unregister", "count", tags)
+		}
+	}
+	if registered("test_unregister", "count", other) {
+		t.Error("expected the stat of other tags to be unregistered")
+	}
+}
+
+func TestTiming(t *testing.T) {
+	s := RegisterTiming("test_timing", "time_ns", nil)
+	defer Unregister("test_timing", "time_ns", nil)
+
+	steps := []struct {
+		samples  []int64
+		expected int64
+	}{
+		{samples: []int64{10, 20}, expected: 15},
+		// without samples the previous average is kept
+		{expected: 15},
+		{samples: []int64{4}, expected: 4},
+	}
+	for i, step := range steps {
+		for _, v := range step.samples {
+			s.Incr(v)
+		}
+		if v := s.Get(); v != step.expected {
+			t.Errorf("step %d: expected %d, got %d", i, step.expected, v)
+		}
+	}
+}
@@ -1,84 +1,420 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/anabiozz/asgard"
 	"github.com/anabiozz/asgard/agent"
 	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/logger"
+	_ "github.com/anabiozz/asgard/plugins/aggregators/all"
 	_ "github.com/anabiozz/asgard/plugins/inputs/all"
 	_ "github.com/anabiozz/asgard/plugins/outputs/all"
+	_ "github.com/anabiozz/asgard/plugins/processors/all"
+	_ "github.com/anabiozz/asgard/plugins/secretstores/all"
 )
 
+var (
+	fConfig          = flag.String("config", "", "configuration file to load, may also be given as first argument")
+	fConfigDirectory = flag.String("config-directory", "", "directory containing additional *.toml configuration files")
+	fWatchConfig     = flag.Bool("watch-config", false, "reload the configuration when a config file changes")
+	fInputFilters    = flag.String("input-filter", "", "colon separated list of inputs to run instead of [InputFilters], e.g. cpu:mem:docker")
+	fOutputFilters   = flag.String("output-filter", "", "colon separated list of outputs to run instead of [OutputFilters], e.g. influxdb:kafka")
+	fTest            = flag.Bool("test", false, "gather metrics once, print them to stdout and exit without writing to outputs")
+	fOnce            = flag.Bool("once", false, "gather metrics once, write them to the outputs and exit")
+
+	fConfigPollInterval = flag.Duration("config-poll-interval", time.Minute, "how often a config given as http(s):// URL is fetched again")
+	fConfigCache        = flag.String("config-cache", "", "file keeping the last good config fetched from a URL, used when the server is unreachable at startup, no copy is kept when empty")
+	fConfigInterpolate  = flag.Bool("config-interpolate", false, "expand ${VAR} and @file:/path references in a config fetched from a URL")
+	fConfigSSLCA        = flag.String("config-ssl-ca", "", "CA file used to verify the config server")
+	fConfigSSLCert      = flag.String("config-ssl-cert", "", "client certificate presented to the config server")
+	fConfigSSLKey       = flag.String("config-ssl-key", "", "key of the client certificate")
+	fConfigInsecure     = flag.Bool("config-insecure-skip-verify", false, "don't verify the certificate of the config server")
+)
+
+const usage = `asgard, the metrics collecting agent.
+
+Usage:
+
+  asgard [flags] [config file or URL]
+  asgard -test [flags] [config file or URL]
+  asgard -once [flags] [config file or URL]
+  asgard [flags] check-config [config file or URL]
+  asgard [-input-filter <inputs>] [-output-filter <outputs>] config
+  asgard -config <config file or URL> secrets set <store id> <key> < value
+
+Commands:
+
+  config        print a sample configuration with every plugin, or only the
+                plugins given by -input-filter and -output-filter
+  secrets set   store the value read from stdin in a secret store, plugins
+                reference it as @{<store id>:<key>}
+  check-config  validate the configuration, reporting unknown plugins,
+                unknown settings and invalid values, then exit
+
+Flags:
+
+`
+
 var stop chan struct{}
 
-func loop(stop chan struct{}) {
-	reload := make(chan bool, 1)
-	reload <- true
-	for <-reload {
-		reload <- false
-
-		// Create new config
-		newConfig := config.NewConfig()
-		// Filling new config getting data from default config
-		err := newConfig.LoadConfig()
-		if err != nil {
-			log.Fatalf("ERROR: %s", err)
-		}
+// remote is set when the config is fetched from a URL
+var remote *config.Remote
 
-		inputs := newConfig.InputFilters["inputs"].([]interface{})
-		outputs := newConfig.OutputFilters["outputs"].([]interface{})
+// watchInterval is how often the config files are polled with -watch-config
+const watchInterval = 5 * time.Second
 
-		// Filling InputFilters
-		for _, value := range inputs {
-			newConfig.AddInput(value.(string))
-		}
-		// Filling OutputFilters
-		for _, value := range outputs {
-			newConfig.AddOutput(value.(string))
-		}
+// loadRemote fetches the config when it is given as URL, falling back to
+// the cached copy of the last good one.
+func loadRemote() error {
+	if !config.IsURL(configPath()) {
+		return nil
+	}
+	r, err := config.NewRemote(config.RemoteConfig{
+		URL:                configPath(),
+		CachePath:          *fConfigCache,
+		Interpolate:        *fConfigInterpolate,
+		SSLCA:              *fConfigSSLCA,
+		SSLCert:            *fConfigSSLCert,
+		SSLKey:             *fConfigSSLKey,
+		InsecureSkipVerify: *fConfigInsecure,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.Load(); err != nil {
+		return err
+	}
+	remote = r
+	return nil
+}
 
-		if len(newConfig.Inputs) == 0 || len(newConfig.Outputs) == 0 {
-			log.Fatalf("ERROR: no inputs or outputs found, did you provide a valid config file?")
-		}
+// loadConfig loads the config files given on the command line, or the last
+// config fetched from the URL given.
+func loadConfig() (*config.Config, error) {
+	c := config.NewConfig()
+	c.SelectedInputs = splitFilter(*fInputFilters)
+	c.SelectedOutputs = splitFilter(*fOutputFilters)
+	var err error
+	if remote != nil {
+		err = c.LoadRemoteConfig(remote, *fConfigDirectory)
+	} else {
+		err = c.LoadConfig(configPath(), *fConfigDirectory)
+	}
+	if err != nil {
+		c.UnregisterStats()
+		return nil, err
+	}
+	if len(c.Inputs) == 0 || (len(c.Outputs) == 0 && !*fTest) {
+		c.UnregisterStats()
+		return nil, fmt.Errorf("no inputs or outputs found, did you provide a valid config file?")
+	}
+	return c, nil
+}
 
-		// Create new agent with confing
-		newAgent, err := agent.NewAgent(newConfig)
-		if err != nil {
-			log.Fatal("ERROR: " + err.Error())
-		}
+// setupLogging applies the logging settings of the config
+func setupLogging(c *config.Config) error {
+	return logger.Setup(logger.Config{
+		Debug:               c.Agent.Debug,
+		Quiet:               c.Agent.Quiet,
+		Logfile:             c.Agent.Logfile,
+		RotationMaxSize:     c.Agent.LogfileRotationMaxSize.Size,
+		RotationMaxArchives: c.Agent.LogfileRotationMaxArchives,
+		Format:              c.Agent.LogFormat,
+	})
+}
 
-		err = newAgent.Connect()
-		if err != nil {
-			log.Fatal("ERROR: " + err.Error())
+// reloadMu serializes reloads requested by signals, config changes and the
+// admin API
+var reloadMu sync.Mutex
+
+// reload loads the config files again and applies them to the running agent.
+// A config that fails to load is reported and the agent keeps running with
+// its current config.
+func reload(a *agent.Agent) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	log.Printf("I! Reloading config\n")
+	newConfig, err := loadConfig()
+	if err != nil {
+		log.Printf("E! Config not reloaded: %s", err)
+		return err
+	}
+	if err := a.Reload(newConfig); err != nil {
+		log.Printf("E! Config not reloaded: %s", err)
+		return err
+	}
+	if err := setupLogging(newConfig); err != nil {
+		log.Printf("E! %s", err)
+	}
+	return nil
+}
+
+// fetchAndReload fetches the remote config, when there is one, before
+// reloading
+func fetchAndReload(a *agent.Agent) error {
+	if remote != nil {
+		if _, err := remote.Fetch(); err != nil {
+			log.Printf("E! %s", err)
 		}
+	}
+	return reload(a)
+}
 
-		shutdown := make(chan struct{})
-		signals := make(chan os.Signal)
-		signal.Notify(signals, os.Interrupt, syscall.SIGHUP)
-		go func() {
+func loop(stop chan struct{}) {
+	if err := loadRemote(); err != nil {
+		log.Fatalf("E! %s", err)
+	}
+	newConfig, err := loadConfig()
+	if err != nil {
+		log.Fatalf("E! %s", err)
+	}
+	if err := setupLogging(newConfig); err != nil {
+		log.Fatalf("E! %s", err)
+	}
+
+	// Create new agent with confing
+	newAgent, err := agent.NewAgent(newConfig)
+	if err != nil {
+		log.Fatal("E! " + err.Error())
+	}
+
+	newAgent.ReloadConfig = func() error { return fetchAndReload(newAgent) }
+
+	err = newAgent.Connect()
+	if err != nil {
+		log.Fatal("E! " + err.Error())
+	}
+
+	var changes, remoteChanges <-chan struct{}
+	if *fWatchConfig {
+		changes = config.Watch(configPath(), *fConfigDirectory, watchInterval, stop)
+	}
+	if remote != nil {
+		remoteChanges = remote.Poll(*fConfigPollInterval, stop)
+	}
+
+	shutdown := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP)
+	go func() {
+		for {
 			select {
 			case sig := <-signals:
 				if sig == os.Interrupt {
 					close(shutdown)
+					return
 				}
 				if sig == syscall.SIGHUP {
-					log.Printf("I! Reloading config\n")
-					<-reload
-					reload <- true
-					close(shutdown)
+					fetchAndReload(newAgent)
 				}
+			case <-changes:
+				reload(newAgent)
+			case <-remoteChanges:
+				reload(newAgent)
 			case <-stop:
 				close(shutdown)
+				return
 			}
-		}()
-		newAgent.Run(shutdown)
+		}
+	}()
+	if err := newAgent.Run(shutdown); err != nil {
+		log.Fatalf("E! %s", err)
+	}
+}
+
+// configPath returns the config file given by the -config flag or as
+// argument, after the command if there is one.
+func configPath() string {
+	if *fConfig != "" {
+		return *fConfig
+	}
+	switch flag.Arg(0) {
+	case "check-config", "config":
+		return flag.Arg(1)
+	case "secrets":
+		return ""
+	}
+	return flag.Arg(0)
+}
+
+// checkConfig loads the configuration the way the agent does and reports every
+// problem found. It returns the exit code of the check-config command.
+func checkConfig() int {
+	if err := loadRemote(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Configuration OK: %d inputs, %d outputs\n", len(c.Inputs), len(c.Outputs))
+	return 0
+}
+
+// splitFilter splits a colon separated list of plugin names
+func splitFilter(filter string) []string {
+	var names []string
+	for _, name := range strings.Split(filter, ":") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// test gathers every input once and prints the metrics, it returns the exit
+// code of the -test mode.
+func test() int {
+	if err := loadRemote(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// metrics go to stdout, logs always to stderr
+	err = logger.Setup(logger.Config{Debug: c.Agent.Debug, Quiet: c.Agent.Quiet, Format: c.Agent.LogFormat})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	a, err := agent.NewAgent(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := a.Test(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// once gathers every input once and writes the metrics to the outputs, it
+// returns the exit code of the -once mode.
+func once() int {
+	if err := loadRemote(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := setupLogging(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	a, err := agent.NewAgent(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := a.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := a.Once(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// setSecret stores a secret read from stdin, it returns the exit code of the
+// secrets command.
+func setSecret() int {
+	if flag.Arg(1) != "set" || flag.NArg() != 4 {
+		fmt.Fprintln(os.Stderr, "usage: asgard -config <config file> secrets set <store id> <key> < value")
+		return 1
+	}
+	id, key := flag.Arg(2), flag.Arg(3)
+
+	if err := loadRemote(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	c := config.NewConfig()
+	var err error
+	if remote != nil {
+		err = c.LoadRemoteConfig(remote, *fConfigDirectory)
+	} else {
+		err = c.LoadConfig(configPath(), *fConfigDirectory)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	store, ok := c.SecretStores[id]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown secret store %q\n", id)
+		return 1
+	}
+	setter, ok := store.(asgard.SecretSetter)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "secret store %q is read only\n", id)
+		return 1
+	}
+
+	value, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := setter.Set(key, bytes.TrimRight(value, "\r\n")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	logger.Setup(logger.Config{})
+
+	switch flag.Arg(0) {
+	case "check-config":
+		os.Exit(checkConfig())
+	case "secrets":
+		os.Exit(setSecret())
+	case "config":
+		err := config.PrintSampleConfig(os.Stdout, splitFilter(*fInputFilters), splitFilter(*fOutputFilters))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *fTest {
+		os.Exit(test())
+	}
+	if *fOnce {
+		os.Exit(once())
+	}
+
 	// TODO: implement a feature that will be obtain all processes in system and to fill inputFilters
 	stop = make(chan struct{})
 	loop(stop)
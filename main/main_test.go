@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/anabiozz/asgard/agent"
+	"github.com/anabiozz/asgard/internal/config"
+	"github.com/anabiozz/asgard/internal/selfstat"
+)
+
+// statSeries returns the measurement and tags of every registered stat
+func statSeries() []string {
+	var series []string
+	for _, m := range selfstat.Metrics() {
+		series = append(series, fmt.Sprintf("%s %v", m.Name(), m.Tags()))
+	}
+	return series
+}
+
+func TestReloadDiscardedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "no inputs", contents: "[[outputs.influxdb]]\n  urls = [\"http://localhost:8086\"]\n"},
+		{name: "invalid", contents: "[[outputs.influxdb]]\n  urls = [\"http://localhost:8086\"]\n[[inputs.cpu]]\n  percpu = \"a\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "asgard.toml")
+			if err := ioutil.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			*fConfig = path
+			defer func() { *fConfig = "" }()
+
+			c := config.NewConfig()
+			c.Agent.OmitHostname = true
+			a, err := agent.NewAgent(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := statSeries()
+			if err := reload(a); err == nil {
+				t.Fatal("expected the config to be discarded")
+			}
+			if after := statSeries(); !reflect.DeepEqual(after, before) {
+				t.Errorf("expected the stats of the discarded plugins to be unregistered, got %q", after)
+			}
+		})
+	}
+}
@@ -377,64 +377,121 @@ func (m *metric) AddTag(key, value string) {
 }
 
 func (m *metric) HasTag(key string) bool {
-	i := bytes.Index(m.tags, []byte(escape(key, "tagkey")+"="))
-	if i == -1 {
-		return false
-	}
-	return true
+	i, _ := m.indexTag(key)
+	return i != -1
 }
 
 func (m *metric) RemoveTag(key string) {
 	m.hashID = 0
 
-	i := bytes.Index(m.tags, []byte(escape(key, "tagkey")+"="))
+	i, j := m.indexTag(key)
 	if i == -1 {
 		return
 	}
+	m.tags = append(m.tags[:i], m.tags[j:]...)
+}
 
-	tmp := m.tags[0 : i-1]
-	j := indexUnescapedByte(m.tags[i:], ',')
-	if j != -1 {
-		tmp = append(tmp, m.tags[i+j:]...)
+// indexTag returns the start and the end of the ",key=value" entry of the
+// tag in m.tags, or -1 when the metric has no such tag. Keys are compared as
+// a whole, so "name" doesn't match "hostname".
+func (m *metric) indexTag(key string) (int, int) {
+	k := []byte(escape(key, "tagkey"))
+	i := 0
+	for i < len(m.tags) {
+		// m.tags[i] is the comma starting the entry
+		end := indexUnescapedByte(m.tags[i+1:], ',')
+		if end == -1 {
+			end = len(m.tags)
+		} else {
+			end += i + 1
+		}
+		i1 := indexUnescapedByte(m.tags[i+1:end], '=')
+		if i1 != -1 && bytes.Equal(m.tags[i+1:i+1+i1], k) {
+			return i, end
+		}
+		i = end
 	}
-	m.tags = tmp
-	return
+	return -1, -1
 }
 
+// AddField adds the field, replacing the value of an existing field of the
+// same key
 func (m *metric) AddField(key string, value interface{}) {
-	m.fields = append(m.fields, ',')
+	if i, j := m.indexField(key); i != -1 {
+		m.removeField(i, j)
+	}
+	if len(m.fields) > 0 {
+		m.fields = append(m.fields, ',')
+	}
 	m.fields = appendField(m.fields, key, value)
 }
 
 func (m *metric) HasField(key string) bool {
-	i := bytes.Index(m.fields, []byte(escape(key, "tagkey")+"="))
-	if i == -1 {
-		return false
-	}
-	return true
+	i, _ := m.indexField(key)
+	return i != -1
 }
 
 func (m *metric) RemoveField(key string) error {
-	i := bytes.Index(m.fields, []byte(escape(key, "tagkey")+"="))
+	i, j := m.indexField(key)
 	if i == -1 {
 		return nil
 	}
-
-	var tmp []byte
-	if i != 0 {
-		tmp = m.fields[0 : i-1]
-	}
-	j := indexUnescapedByte(m.fields[i:], ',')
-	if j != -1 {
-		tmp = append(tmp, m.fields[i+j:]...)
+	if i == 0 && j == len(m.fields) {
+		return fmt.Errorf("Metric cannot remove final field: %s", m.fields)
 	}
+	m.removeField(i, j)
+	return nil
+}
 
-	if len(tmp) == 0 {
-		return fmt.Errorf("Metric cannot remove final field: %s", m.fields)
+// removeField removes the "key=value" entry from i to j of m.fields along
+// with its separating comma
+func (m *metric) removeField(i, j int) {
+	switch {
+	case j < len(m.fields):
+		m.fields = append(m.fields[:i], m.fields[j+1:]...)
+	case i > 0:
+		m.fields = m.fields[:i-1]
+	default:
+		m.fields = m.fields[:0]
 	}
+}
 
-	m.fields = tmp
-	return nil
+// indexField returns the start and the end of the "key=value" entry of the
+// field in m.fields, or -1 when the metric has no such field. Keys are
+// compared as a whole and string values are skipped, like Fields does.
+func (m *metric) indexField(key string) (int, int) {
+	k := []byte(escape(key, "tagkey"))
+	i := 0
+	for i < len(m.fields) {
+		// end index of field key
+		i1 := indexUnescapedByte(m.fields[i:], '=')
+		if i1 == -1 {
+			break
+		}
+		i2 := i1 + 1
+
+		// end index of field value
+		var i3 int
+		if i2 < len(m.fields[i:]) && m.fields[i:][i2] == '"' {
+			i3 = indexUnescapedByteBackslashEscaping(m.fields[i:][i2+1:], '"')
+			if i3 == -1 {
+				i3 = len(m.fields[i:])
+			} else {
+				i3 += i2 + 2
+			}
+		} else {
+			i3 = indexUnescapedByte(m.fields[i:], ',')
+			if i3 == -1 {
+				i3 = len(m.fields[i:])
+			}
+		}
+
+		if bytes.Equal(m.fields[i:i+i1], k) {
+			return i, i + i3
+		}
+		i += i3 + 1
+	}
+	return -1, -1
 }
 
 func (m *metric) Copy() asgard.Metric {
@@ -600,8 +657,11 @@ func New(
 	}
 	m.tags = make([]byte, taglen)
 
+	// tags and fields are written sorted by key, so a metric always has the
+	// same line protocol representation
 	i := 0
-	for k, v := range tags {
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
 		if len(k) == 0 || len(v) == 0 {
 			continue
 		}
@@ -627,14 +687,29 @@ func New(
 	}
 	m.fields = make([]byte, 0, fieldlen)
 
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+
 	i = 0
-	for k, v := range fields {
+	for _, k := range fieldKeys {
 		if i != 0 {
 			m.fields = append(m.fields, ',')
 		}
-		m.fields = appendField(m.fields, k, v)
+		m.fields = appendField(m.fields, k, fields[k])
 		i++
 	}
 
 	return m, nil
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard"
+)
+
+var now = time.Unix(0, 1500000000000000000)
+
+func newMetric(t *testing.T, tags map[string]string, fields map[string]interface{}) asgard.Metric {
+	m, err := New("mem", tags, fields, now)
+	if err != nil {
+		t.Fatalf("Error creating metric: %s", err)
+	}
+	return m
+}
+
+func TestNewSortsTagsAndFields(t *testing.T) {
+	m := newMetric(t,
+		map[string]string{"b": "2", "a": "1", "empty": ""},
+		map[string]interface{}{"y": int64(2), "x": 1.5, "s": "v"},
+	)
+	expected := "mem,a=1,b=2 s=\"v\",x=1.5,y=2i 1500000000000000000\n"
+	if got := m.String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestTagKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     map[string]string
+		key      string
+		has      bool
+		expected map[string]string
+	}{
+		{
+			name:     "exact key",
+			tags:     map[string]string{"host": "a", "hostname": "b"},
+			key:      "host",
+			has:      true,
+			expected: map[string]string{"hostname": "b"},
+		},
+		{
+			name:     "key is a suffix of another",
+			tags:     map[string]string{"hostname": "b"},
+			key:      "name",
+			has:      false,
+			expected: map[string]string{"hostname": "b"},
+		},
+		{
+			name:     "key matches a value",
+			tags:     map[string]string{"a": "host=x"},
+			key:      "host",
+			has:      false,
+			expected: map[string]string{"a": "host=x"},
+		},
+		{
+			name:     "escaped key",
+			tags:     map[string]string{"a b": "1", "c,d": "2", "e": "3"},
+			key:      "c,d",
+			has:      true,
+			expected: map[string]string{"a b": "1", "e": "3"},
+		},
+		{
+			name:     "last tag",
+			tags:     map[string]string{"a": "1", "z": "2"},
+			key:      "z",
+			has:      true,
+			expected: map[string]string{"a": "1"},
+		},
+		{
+			name:     "only tag",
+			tags:     map[string]string{"a": "1"},
+			key:      "a",
+			has:      true,
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMetric(t, tt.tags, map[string]interface{}{"value": int64(1)})
+			if has := m.HasTag(tt.key); has != tt.has {
+				t.Errorf("HasTag(%q): expected %v, got %v", tt.key, tt.has, has)
+			}
+			m.RemoveTag(tt.key)
+			assertTags(t, m, tt.expected)
+		})
+	}
+}
+
+func TestAddTagReplaces(t *testing.T) {
+	m := newMetric(t, map[string]string{"host": "a", "hostname": "b"}, map[string]interface{}{"value": int64(1)})
+	m.AddTag("host", "c")
+	assertTags(t, m, map[string]string{"host": "c", "hostname": "b"})
+}
+
+func TestFieldKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]interface{}
+		key      string
+		has      bool
+		err      bool
+		expected map[string]interface{}
+	}{
+		{
+			name:     "exact key",
+			fields:   map[string]interface{}{"cached": int64(1), "swap_cached": int64(2)},
+			key:      "cached",
+			has:      true,
+			expected: map[string]interface{}{"swap_cached": int64(2)},
+		},
+		{
+			name:     "key is a suffix of another",
+			fields:   map[string]interface{}{"swap_cached": int64(2), "x": int64(1)},
+			key:      "cached",
+			has:      false,
+			expected: map[string]interface{}{"swap_cached": int64(2), "x": int64(1)},
+		},
+		{
+			name:     "key inside a string value",
+			fields:   map[string]interface{}{"a": "x,cached=1", "b": int64(1)},
+			key:      "cached",
+			has:      false,
+			expected: map[string]interface{}{"a": "x,cached=1", "b": int64(1)},
+		},
+		{
+			name:     "field after a string value",
+			fields:   map[string]interface{}{"a": "x,y=\"z\"", "b": int64(1), "c": true},
+			key:      "b",
+			has:      true,
+			expected: map[string]interface{}{"a": "x,y=\"z\"", "c": true},
+		},
+		{
+			name:     "escaped key",
+			fields:   map[string]interface{}{"a b": int64(1), "a": int64(2)},
+			key:      "a b",
+			has:      true,
+			expected: map[string]interface{}{"a": int64(2)},
+		},
+		{
+			name:     "first field",
+			fields:   map[string]interface{}{"a": int64(1), "b": int64(2)},
+			key:      "a",
+			has:      true,
+			expected: map[string]interface{}{"b": int64(2)},
+		},
+		{
+			name:     "last field",
+			fields:   map[string]interface{}{"a": int64(1), "b": int64(2)},
+			key:      "b",
+			has:      true,
+			expected: map[string]interface{}{"a": int64(1)},
+		},
+		{
+			name:     "final field",
+			fields:   map[string]interface{}{"a": int64(1)},
+			key:      "a",
+			has:      true,
+			err:      true,
+			expected: map[string]interface{}{"a": int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMetric(t, nil, tt.fields)
+			if has := m.HasField(tt.key); has != tt.has {
+				t.Errorf("HasField(%q): expected %v, got %v", tt.key, tt.has, has)
+			}
+			err := m.RemoveField(tt.key)
+			if (err != nil) != tt.err {
+				t.Errorf("RemoveField(%q): expected error %v, got %v", tt.key, tt.err, err)
+			}
+			assertFields(t, m, tt.expected)
+		})
+	}
+}
+
+func TestAddField(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   map[string]interface{}
+		key      string
+		value    interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name:     "new key",
+			fields:   map[string]interface{}{"a": int64(1)},
+			key:      "b",
+			value:    int64(2),
+			expected: map[string]interface{}{"a": int64(1), "b": int64(2)},
+		},
+		{
+			name:     "existing key",
+			fields:   map[string]interface{}{"a": int64(1), "b": int64(2)},
+			key:      "a",
+			value:    "x",
+			expected: map[string]interface{}{"a": "x", "b": int64(2)},
+		},
+		{
+			name:     "only key",
+			fields:   map[string]interface{}{"a": int64(1)},
+			key:      "a",
+			value:    2.5,
+			expected: map[string]interface{}{"a": 2.5},
+		},
+		{
+			name:     "existing string value",
+			fields:   map[string]interface{}{"a": "x,b=1", "b": int64(2)},
+			key:      "a",
+			value:    "y",
+			expected: map[string]interface{}{"a": "y", "b": int64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMetric(t, nil, tt.fields)
+			m.AddField(tt.key, tt.value)
+			assertFields(t, m, tt.expected)
+		})
+	}
+}
+
+func assertTags(t *testing.T, m asgard.Metric, expected map[string]string) {
+	t.Helper()
+	tags := m.Tags()
+	if len(tags) != len(expected) {
+		t.Fatalf("expected tags %v, got %v", expected, tags)
+	}
+	for k, v := range expected {
+		if tags[k] != v {
+			t.Fatalf("expected tags %v, got %v", expected, tags)
+		}
+	}
+}
+
+func assertFields(t *testing.T, m asgard.Metric, expected map[string]interface{}) {
+	t.Helper()
+	fields := m.Fields()
+	if len(fields) != len(expected) {
+		t.Fatalf("expected fields %v, got %v (%s)", expected, fields, m.String())
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Fatalf("expected fields %v, got %v (%s)", expected, fields, m.String())
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package all
+
+import (
+	_ "github.com/anabiozz/asgard/plugins/aggregators/basicstats"
+)
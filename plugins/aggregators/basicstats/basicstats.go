@@ -0,0 +1,175 @@
+package basicstats
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/plugins/aggregators"
+)
+
+// validStats are the statistics basicstats computes
+var validStats = []string{"count", "min", "max", "mean", "stddev"}
+
+// BasicStats computes the count, min, max, mean and standard deviation of the
+// numeric fields of every series over a period
+type BasicStats struct {
+	Stats []string `toml:"stats"`
+
+	Log asgard.Logger `toml:"-"`
+
+	stats  map[string]bool
+	series map[uint64]*aggregate
+}
+
+// aggregate holds the statistics of the fields of one series
+type aggregate struct {
+	name   string
+	tags   map[string]string
+	fields map[string]*fieldStats
+}
+
+// fieldStats is computed with Welford's online algorithm, so the variance
+// doesn't lose precision on large values
+type fieldStats struct {
+	count int64
+	min   float64
+	max   float64
+	mean  float64
+	// m2 is the sum of the squared differences to the mean
+	m2 float64
+}
+
+var sampleConfig = `
+  ## Length of the periods aggregated
+  period = "30s"
+  ## Don't write the metrics the aggregator takes to the outputs
+  drop_original = false
+
+  ## Statistics computed for every numeric field, written as <field>_<stat>.
+  ## Any of "count", "min", "max", "mean" and "stddev", all by default.
+  # stats = ["count", "min", "max", "mean", "stddev"]
+`
+
+func (*BasicStats) SampleConfig() string {
+	return sampleConfig
+}
+
+func (*BasicStats) Description() string {
+	return "Keep the count, min, max, mean and standard deviation of numeric fields over each period"
+}
+
+// Init checks the statistics asked for
+func (b *BasicStats) Init() error {
+	if len(b.Stats) == 0 {
+		b.Stats = validStats
+	}
+	b.stats = make(map[string]bool, len(b.Stats))
+	for _, stat := range b.Stats {
+		if !isValidStat(stat) {
+			return fmt.Errorf("Unknown stat %q, expected one of %v", stat, validStats)
+		}
+		b.stats[stat] = true
+	}
+	return nil
+}
+
+func isValidStat(stat string) bool {
+	for _, s := range validStats {
+		if s == stat {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the numeric fields of the metric to the statistics of its series
+func (b *BasicStats) Add(in asgard.Metric) {
+	id := in.HashID()
+	a, ok := b.series[id]
+	if !ok {
+		a = &aggregate{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]*fieldStats),
+		}
+		b.series[id] = a
+	}
+
+	for k, v := range in.Fields() {
+		value, ok := convert(v)
+		if !ok {
+			continue
+		}
+		fs, ok := a.fields[k]
+		if !ok {
+			a.fields[k] = &fieldStats{count: 1, min: value, max: value, mean: value}
+			continue
+		}
+		fs.count++
+		if value < fs.min {
+			fs.min = value
+		}
+		if value > fs.max {
+			fs.max = value
+		}
+		delta := value - fs.mean
+		fs.mean += delta / float64(fs.count)
+		fs.m2 += delta * (value - fs.mean)
+	}
+}
+
+// Push adds a metric with the statistics of every series to acc
+func (b *BasicStats) Push(acc asgard.Accumulator) {
+	for _, a := range b.series {
+		fields := make(map[string]interface{})
+		for k, fs := range a.fields {
+			if b.stats["count"] {
+				fields[k+"_count"] = fs.count
+			}
+			if b.stats["min"] {
+				fields[k+"_min"] = fs.min
+			}
+			if b.stats["max"] {
+				fields[k+"_max"] = fs.max
+			}
+			if b.stats["mean"] {
+				fields[k+"_mean"] = fs.mean
+			}
+			// the sample standard deviation needs two values
+			if b.stats["stddev"] && fs.count > 1 {
+				fields[k+"_stddev"] = math.Sqrt(fs.m2 / float64(fs.count-1))
+			}
+		}
+		if len(fields) > 0 {
+			acc.AddFields(a.name, fields, a.tags)
+		}
+	}
+}
+
+// Reset clears the statistics of every series
+func (b *BasicStats) Reset() {
+	b.series = make(map[uint64]*aggregate)
+}
+
+// convert returns the value of a numeric field as a float64
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("basicstats", func() asgard.Aggregator {
+		return &BasicStats{
+			series: make(map[uint64]*aggregate),
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package basicstats
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard/metric"
+)
+
+// fieldsAccumulator keeps the fields added by measurement and tag "host"
+type fieldsAccumulator map[string]map[string]interface{}
+
+func (a fieldsAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a[measurement+","+tags["host"]] = fields
+}
+func (a fieldsAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a fieldsAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a fieldsAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a fieldsAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (fieldsAccumulator) SetPrecision(precision, interval time.Duration) {}
+func (fieldsAccumulator) AddError(err error)                             {}
+
+func TestBasicStats(t *testing.T) {
+	type input struct {
+		host   string
+		fields map[string]interface{}
+	}
+
+	tests := []struct {
+		name     string
+		stats    []string
+		inputs   []input
+		expected map[string]map[string]interface{}
+		err      string
+	}{
+		{
+			name: "all stats",
+			inputs: []input{
+				{host: "a", fields: map[string]interface{}{"v": int64(2)}},
+				{host: "a", fields: map[string]interface{}{"v": 4.0}},
+				{host: "a", fields: map[string]interface{}{"v": uint64(6)}},
+			},
+			expected: map[string]map[string]interface{}{
+				"m,a": {"v_count": int64(3), "v_min": 2.0, "v_max": 6.0, "v_mean": 4.0, "v_stddev": 2.0},
+			},
+		},
+		{
+			name:  "series and non numeric fields",
+			stats: []string{"count", "stddev"},
+			inputs: []input{
+				{host: "a", fields: map[string]interface{}{"v": 1.0, "s": "text"}},
+				{host: "b", fields: map[string]interface{}{"v": 1.0}},
+				{host: "b", fields: map[string]interface{}{"v": 3.0}},
+			},
+			expected: map[string]map[string]interface{}{
+				// a single value has no standard deviation
+				"m,a": {"v_count": int64(1)},
+				"m,b": {"v_count": int64(2), "v_stddev": math.Sqrt(2)},
+			},
+		},
+		{
+			name:     "large values",
+			stats:    []string{"stddev"},
+			inputs:   []input{{fields: map[string]interface{}{"v": 1e9 + 4}}, {fields: map[string]interface{}{"v": 1e9 + 7}}, {fields: map[string]interface{}{"v": 1e9 + 13}}, {fields: map[string]interface{}{"v": 1e9 + 16}}},
+			expected: map[string]map[string]interface{}{"m,": {"v_stddev": math.Sqrt(30)}},
+		},
+		{
+			name:  "unknown stat",
+			stats: []string{"median"},
+			err:   `Unknown stat "median"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BasicStats{Stats: tt.stats, series: make(map[uint64]*aggregate)}
+			err := b.Init()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, in := range tt.inputs {
+				tags := map[string]string{}
+				if in.host != "" {
+					tags["host"] = in.host
+				}
+				m, err := metric.New("m", tags, in.fields, time.Unix(0, 0))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b.Add(m)
+			}
+			acc := fieldsAccumulator{}
+			b.Push(acc)
+			if !reflect.DeepEqual(map[string]map[string]interface{}(acc), tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, acc)
+			}
+
+			b.Reset()
+			acc = fieldsAccumulator{}
+			b.Push(acc)
+			if len(acc) != 0 {
+				t.Errorf("expected nothing pushed after a reset, got %v", acc)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package aggregators
+
+import "github.com/anabiozz/asgard"
+
+// Creator returns a new instance of an aggregator
+type Creator func() asgard.Aggregator
+
+// Aggregators are the registered aggregators by name
+var Aggregators = map[string]Creator{}
+
+// Add registers an aggregator, it is called from the init function of the
+// aggregator package
+func Add(name string, creator Creator) {
+	Aggregators[name] = creator
+}
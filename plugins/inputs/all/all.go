@@ -3,5 +3,6 @@ package all
 import (
 	_ "github.com/anabiozz/asgard/plugins/inputs/docker"
 	_ "github.com/anabiozz/asgard/plugins/inputs/influxdb"
+	_ "github.com/anabiozz/asgard/plugins/inputs/internal"
 	_ "github.com/anabiozz/asgard/plugins/inputs/system"
 )
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -25,11 +24,10 @@ import (
 // Docker object
 type Docker struct {
 	Endpoint       string
-	ContainerNames []string
+	ContainerNames []string `toml:"container_names"`
 
 	GatherServices bool `toml:"gather_services"`
 
-	Timeout        internal.Duration
 	PerDevice      bool     `toml:"perdevice"`
 	Total          bool     `toml:"total"`
 	TagEnvironment []string `toml:"tag_env"`
@@ -42,7 +40,9 @@ type Docker struct {
 	SSLCA              string `toml:"ssl_ca"`
 	SSLCert            string `toml:"ssl_cert"`
 	SSLKey             string `toml:"ssl_key"`
-	InsecureSkipVerify bool
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"`
+
+	Log asgard.Logger `toml:"-"`
 
 	newEnvClient func() (Client, error)
 	newClient    func(string, *tls.Config) (Client, error)
@@ -50,7 +50,6 @@ type Docker struct {
 	client          Client
 	httpClient      *http.Client
 	engine_host     string
-	filtersCreated  bool
 	labelFilter     filter.Filter
 	containerFilter filter.Filter
 }
@@ -63,7 +62,7 @@ const (
 	TB = 1000 * GB
 	PB = 1000 * TB
 
-	defaultEndpoint = "tcp:127.0.0.1:2375"
+	defaultEndpoint = "tcp://127.0.0.1:2375"
 	// unix:///var/run/docker.sock
 
 )
@@ -89,7 +88,8 @@ var sampleConfig = `
   container_name_include = []
   container_name_exclude = []
 
-  ## Timeout for docker list, info, and stats commands
+  ## Timeout of a gather, the docker list, info and stats requests are
+  ## cancelled once it expires. Defaults to the interval.
   timeout = "5s"
 
   ## Whether to report for each container per-device blkio (8:0, 8:1...) and
@@ -119,66 +119,58 @@ func (d *Docker) Description() string {
 
 func (d *Docker) SampleConfig() string { return sampleConfig }
 
-func (d *Docker) Gather(acc asgard.Accumulator) error {
-
-	if d.client == nil {
-		var c Client
-		var err error
-		if d.Endpoint == "ENV" {
-			c, err = d.newEnvClient()
-		} else {
-			tlsConfig, err := internal.GetTLSConfig(d.SSLCert, d.SSLKey, d.SSLCA, d.InsecureSkipVerify)
-			if err != nil {
-				fmt.Printf("ERR GetTLSConfig: %s", err)
-				return err
-			}
-
-			c, err = d.newClient(d.Endpoint, tlsConfig)
-		}
-		if err != nil {
-			fmt.Printf("ERR: %s", err)
-			return err
-		}
-		d.client = c
+// Init builds the container and label filters and creates the client
+func (d *Docker) Init() error {
+	if err := d.createLabelFilters(); err != nil {
+		return fmt.Errorf("Error creating label filters: %s", err)
+	}
+	if err := d.createContainerFilters(); err != nil {
+		return fmt.Errorf("Error creating container filters: %s", err)
 	}
 
-	// Create label filters if not already created
-	if !d.filtersCreated {
-		err := d.createLabelFilters()
-		if err != nil {
-			fmt.Printf("ERR createLabelFilters: %s", err)
-			return err
-		}
-		err = d.createContainerFilters()
+	var c Client
+	var err error
+	if d.Endpoint == "ENV" {
+		c, err = d.newEnvClient()
+	} else {
+		var tlsConfig *tls.Config
+		tlsConfig, err = internal.GetTLSConfig(d.SSLCert, d.SSLKey, d.SSLCA, d.InsecureSkipVerify)
 		if err != nil {
-			fmt.Printf("ERR createContainerFilters: %s", err)
 			return err
 		}
-		d.filtersCreated = true
+		c, err = d.newClient(d.Endpoint, tlsConfig)
 	}
+	if err != nil {
+		return fmt.Errorf("Error creating client for %s: %s", d.Endpoint, err)
+	}
+	d.client = c
+	return nil
+}
+
+func (d *Docker) Gather(acc asgard.Accumulator) error {
+	return d.GatherContext(context.Background(), acc)
+}
 
+// GatherContext gathers the daemon, swarm and container metrics, the
+// requests to the daemon are cancelled once ctx is done
+func (d *Docker) GatherContext(ctx context.Context, acc asgard.Accumulator) error {
 	// Get daemon info
-	err := d.gatherInfo(acc)
+	err := d.gatherInfo(ctx, acc)
 	if err != nil {
-		fmt.Printf("ERR gatherInfo: %s", err)
 		acc.AddError(err)
 	}
 
 	if d.GatherServices {
-		err := d.gatherSwarmInfo(acc)
+		err := d.gatherSwarmInfo(ctx, acc)
 		if err != nil {
-			fmt.Printf("ERR gatherSwarmInfo: %s", err)
 			acc.AddError(err)
 		}
 	}
 
 	// List containers
 	opts := types.ContainerListOptions{}
-	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout.Duration)
-	defer cancel()
 	containers, err := d.client.ContainerList(ctx, opts)
 	if err != nil {
-		fmt.Printf("ERR ContainerList: %s", err)
 		return err
 	}
 
@@ -188,9 +180,9 @@ func (d *Docker) Gather(acc asgard.Accumulator) error {
 	for _, container := range containers {
 		go func(c types.Container) {
 			defer wg.Done()
-			err := d.gatherContainer(c, acc)
+			err := d.gatherContainer(ctx, c, acc)
 			if err != nil {
-				acc.AddError(fmt.Errorf("E! Error gathering container %s stats: %s\n",
+				acc.AddError(fmt.Errorf("Error gathering container %s stats: %s",
 					c.Names, err.Error()))
 			}
 		}(container)
@@ -200,10 +192,7 @@ func (d *Docker) Gather(acc asgard.Accumulator) error {
 	return nil
 }
 
-func (d *Docker) gatherSwarmInfo(acc asgard.Accumulator) error {
-
-	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout.Duration)
-	defer cancel()
+func (d *Docker) gatherSwarmInfo(ctx context.Context, acc asgard.Accumulator) error {
 	services, err := d.client.ServiceList(ctx, types.ServiceListOptions{})
 	if err != nil {
 		return err
@@ -256,7 +245,7 @@ func (d *Docker) gatherSwarmInfo(acc asgard.Accumulator) error {
 				fields["tasks_running"] = running[service.ID]
 				fields["tasks_desired"] = tasksNoShutdown[service.ID]
 			} else {
-				log.Printf("E! Unknow Replicas Mode")
+				d.Log.Warnf("Unknown replicas mode of service %s", service.Spec.Name)
 			}
 			// Add metrics
 			acc.AddFields("docker_swarm",
@@ -269,15 +258,12 @@ func (d *Docker) gatherSwarmInfo(acc asgard.Accumulator) error {
 	return nil
 }
 
-func (d *Docker) gatherInfo(acc asgard.Accumulator) error {
+func (d *Docker) gatherInfo(ctx context.Context, acc asgard.Accumulator) error {
 	// Init vars
 	dataFields := make(map[string]interface{})
 	metadataFields := make(map[string]interface{})
 	now := time.Now()
 	// Get info from docker daemon
-	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout.Duration)
-	defer cancel()
-	fmt.Printf("ERROR: %v", ctx)
 	info, err := d.client.Info(ctx)
 	if err != nil {
 		return err
@@ -329,8 +315,6 @@ func (d *Docker) gatherInfo(acc asgard.Accumulator) error {
 		}
 	}
 
-	fmt.Println(dataFields)
-
 	if len(dataFields) > 0 {
 		acc.AddFields("docker_data",
 			dataFields,
@@ -347,6 +331,7 @@ func (d *Docker) gatherInfo(acc asgard.Accumulator) error {
 }
 
 func (d *Docker) gatherContainer(
+	ctx context.Context,
 	container types.Container,
 	acc asgard.Accumulator,
 ) error {
@@ -381,8 +366,6 @@ func (d *Docker) gatherContainer(
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), d.Timeout.Duration)
-	defer cancel()
 	r, err := d.client.ContainerStats(ctx, container.ID, false)
 	if err != nil {
 		return fmt.Errorf("Error getting docker stats: %s", err.Error())
@@ -775,12 +758,10 @@ func (d *Docker) createLabelFilters() error {
 func init() {
 	inputs.Add("docker", func() asgard.Input {
 		return &Docker{
-			PerDevice:      true,
-			Timeout:        internal.Duration{Duration: time.Second * 5},
-			Endpoint:       defaultEndpoint,
-			newEnvClient:   NewEnvClient,
-			newClient:      NewClient,
-			filtersCreated: false,
+			PerDevice:    true,
+			Endpoint:     defaultEndpoint,
+			newEnvClient: NewEnvClient,
+			newClient:    NewClient,
 		}
 	})
 }
@@ -1,10 +1,13 @@
 package influxdb
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
@@ -13,6 +16,10 @@ import (
 	"github.com/anabiozz/asgard/plugins/inputs"
 )
 
+// requestTimeout bounds connecting and waiting for the response headers, for
+// gathers without a timeout
+const requestTimeout = 5 * time.Second
+
 type InfluxDB struct {
 	URLs []string `toml:"urls"`
 	// Path to CA file
@@ -22,9 +29,7 @@ type InfluxDB struct {
 	// Path to cert key file
 	SSLKey string `toml:"ssl_key"`
 	// Use SSL but skip chain & host verification
-	InsecureSkipVerify bool
-
-	Timeout internal.Duration
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
 
 	client *http.Client
 }
@@ -52,37 +57,54 @@ func (*InfluxDB) SampleConfig() string {
   ## Use SSL but skip chain & host verification
   # insecure_skip_verify = false
 
-  ## http request & header timeout
+  ## Timeout of a gather, the requests are cancelled once it expires.
+  ## Defaults to the interval.
   timeout = "5s"
 `
 }
 
-func (i *InfluxDB) Gather(acc asgard.Accumulator) error {
+// Init checks the URLs and creates the client
+func (i *InfluxDB) Init() error {
 	if len(i.URLs) == 0 {
 		i.URLs = []string{"http://localhost:8086/debug/vars"}
 	}
-
-	if i.client == nil {
-		tlsCfg, err := internal.GetTLSConfig(
-			i.SSLCert, i.SSLKey, i.SSLCA, i.InsecureSkipVerify)
+	for _, u := range i.URLs {
+		parsed, err := url.Parse(u)
 		if err != nil {
-			return err
+			return fmt.Errorf("Error parsing url %q: %s", u, err)
 		}
-		i.client = &http.Client{
-			Transport: &http.Transport{
-				ResponseHeaderTimeout: i.Timeout.Duration,
-				TLSClientConfig:       tlsCfg,
-			},
-			Timeout: i.Timeout.Duration,
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("Unsupported scheme in url %q, expected http or https", u)
 		}
 	}
 
+	tlsCfg, err := internal.GetTLSConfig(
+		i.SSLCert, i.SSLKey, i.SSLCA, i.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	i.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: requestTimeout}).DialContext,
+			ResponseHeaderTimeout: requestTimeout,
+			TLSClientConfig:       tlsCfg,
+		},
+	}
+	return nil
+}
+
+func (i *InfluxDB) Gather(acc asgard.Accumulator) error {
+	return i.GatherContext(context.Background(), acc)
+}
+
+// GatherContext reads every URL, the requests are cancelled once ctx is done
+func (i *InfluxDB) GatherContext(ctx context.Context, acc asgard.Accumulator) error {
 	var wg sync.WaitGroup
 	for _, u := range i.URLs {
 		wg.Add(1)
 		go func(url string) {
 			defer wg.Done()
-			if err := i.gatherURL(acc, url); err != nil {
+			if err := i.gatherURL(ctx, acc, url); err != nil {
 				acc.AddError(fmt.Errorf("[url=%s]: %s", url, err))
 			}
 		}(u)
@@ -131,19 +153,25 @@ type memstats struct {
 
 // Gathers data from a particular URL
 // Parameters:
+//     ctx    : cancels the request
 //     acc    : The telegraf Accumulator to use
 //     url    : endpoint to send request to
 //
 // Returns:
 //     error: Any error that may have occurred
 func (i *InfluxDB) gatherURL(
+	ctx context.Context,
 	acc asgard.Accumulator,
 	url string,
 ) error {
 	shardCounter := 0
 	now := time.Now()
 
-	resp, err := i.client.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := i.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -165,6 +193,11 @@ func (i *InfluxDB) gatherURL(
 
 	// Loop through rest of object
 	for {
+		// Stop decoding once the gather was cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Nothing left in this object, we're done
 		if !dec.More() {
 			break
@@ -265,8 +298,6 @@ func (i *InfluxDB) gatherURL(
 
 func init() {
 	inputs.Add("influxdb", func() asgard.Input {
-		return &InfluxDB{
-			Timeout: internal.Duration{Duration: time.Second * 5},
-		}
+		return &InfluxDB{}
 	})
 }
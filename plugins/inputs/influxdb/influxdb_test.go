@@ -0,0 +1,154 @@
+package influxdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAccumulator records the measurements and errors added
+type testAccumulator struct {
+	mu           sync.Mutex
+	measurements []string
+	errors       []error
+}
+
+func (a *testAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.measurements = append(a.measurements, measurement)
+}
+func (a *testAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *testAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *testAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *testAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	a.AddFields(measurement, fields, tags, t...)
+}
+func (a *testAccumulator) SetPrecision(precision, interval time.Duration) {}
+func (a *testAccumulator) AddError(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.errors = append(a.errors, err)
+}
+
+const vars = `{
+  "cmdline": ["influxd"],
+  "shard:1": {"name": "shard", "tags": {"id": "1"}, "values": {"fieldsCreate": 5}},
+  "write": {"name": "write", "tags": {}, "values": {"pointReq": 10}}
+}`
+
+func TestGatherContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		timeout time.Duration
+		// measurements are the measurements added, sorted
+		measurements []string
+		err          string
+	}{
+		{
+			name:         "vars",
+			handler:      func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, vars) },
+			timeout:      time.Second,
+			measurements: []string{"influxdb", "influxdb_shard", "influxdb_write"},
+		},
+		{
+			name:    "not an object",
+			handler: func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "[]") },
+			timeout: time.Second,
+			err:     "document root must be a JSON object",
+		},
+		{
+			name: "cancelled",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			},
+			timeout: 50 * time.Millisecond,
+			err:     "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.handler)
+			defer ts.Close()
+
+			i := &InfluxDB{URLs: []string{ts.URL}}
+			if err := i.Init(); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			acc := &testAccumulator{}
+			start := time.Now()
+			if err := i.GatherContext(ctx, acc); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the gather to stop after %s, took %s", tt.timeout, elapsed)
+			}
+
+			if tt.err != "" {
+				if len(acc.errors) != 1 || !strings.Contains(acc.errors[0].Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, acc.errors)
+				}
+				return
+			}
+			if len(acc.errors) > 0 {
+				t.Fatalf("unexpected errors: %v", acc.errors)
+			}
+			sort.Strings(acc.measurements)
+			if strings.Join(acc.measurements, ",") != strings.Join(tt.measurements, ",") {
+				t.Errorf("expected %q, got %q", tt.measurements, acc.measurements)
+			}
+		})
+	}
+}
+
+func TestInitURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []string
+		invalid bool
+	}{
+		{name: "default"},
+		{name: "http and https", urls: []string{"http://a:8086/debug/vars", "https://b:8086/debug/vars"}},
+		{name: "unknown scheme", urls: []string{"http://a:8086/debug/vars", "tcp://b:8086"}, invalid: true},
+		{name: "unparsable", urls: []string{"http://a:8086/%zz"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &InfluxDB{URLs: tt.urls}
+			if err := i.Init(); (err != nil) != tt.invalid {
+				t.Errorf("expected error %v, got %v", tt.invalid, err)
+			}
+		})
+	}
+}
+
+func TestInitTransport(t *testing.T) {
+	i := &InfluxDB{}
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	transport := i.client.Transport.(*http.Transport)
+	if transport.ResponseHeaderTimeout != requestTimeout || transport.DialContext == nil {
+		t.Errorf("expected a response header and dial timeout of %s", requestTimeout)
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"runtime"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal/selfstat"
+	"github.com/anabiozz/asgard/plugins/inputs"
+)
+
+// Self reports statistics about the agent itself
+type Self struct {
+	CollectMemstats bool `toml:"collect_memstats"`
+}
+
+func NewSelf() asgard.Input {
+	return &Self{
+		CollectMemstats: true,
+	}
+}
+
+var sampleConfig = `
+  ## Report the memory statistics of the Go runtime of the agent
+  collect_memstats = true
+`
+
+func (s *Self) Description() string {
+	return "Collect statistics about the agent itself"
+}
+
+func (s *Self) SampleConfig() string {
+	return sampleConfig
+}
+
+// Gather reports
+//
+//	internal_gather: gather_time_ns, metrics_gathered and errors per input
+//	internal_write: metrics_written, metrics_dropped, buffer_size,
+//	  buffer_limit and write_time_ns per output
+//	internal_memstats: the Go runtime memory statistics
+//
+// The stats of a plugin instance are tagged with its alias, or without one
+// with its instance number.
+func (s *Self) Gather(acc asgard.Accumulator) error {
+	if s.CollectMemstats {
+		m := &runtime.MemStats{}
+		runtime.ReadMemStats(m)
+		fields := map[string]interface{}{
+			"alloc_bytes":         m.Alloc,
+			"total_alloc_bytes":   m.TotalAlloc,
+			"sys_bytes":           m.Sys,
+			"pointer_lookups":     m.Lookups,
+			"mallocs":             m.Mallocs,
+			"frees":               m.Frees,
+			"heap_alloc_bytes":    m.HeapAlloc,
+			"heap_sys_bytes":      m.HeapSys,
+			"heap_idle_bytes":     m.HeapIdle,
+			"heap_in_use_bytes":   m.HeapInuse,
+			"heap_released_bytes": m.HeapReleased,
+			"heap_objects":        m.HeapObjects,
+			"num_gc":              m.NumGC,
+			"num_goroutines":      runtime.NumGoroutine(),
+		}
+		acc.AddGauge("internal_memstats", fields, nil)
+	}
+
+	for _, m := range selfstat.Metrics() {
+		acc.AddFields(m.Name(), m.Fields(), m.Tags())
+	}
+
+	return nil
+}
+
+func init() {
+	inputs.Add("internal", NewSelf)
+}
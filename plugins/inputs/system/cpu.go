@@ -21,7 +21,7 @@ type CPUStats struct {
 }
 
 func (_ *CPUStats) Description() string {
-	return "Read metrics about memory usage"
+	return "Read metrics about cpu usage"
 }
 
 func (_ *CPUStats) SampleConfig() string { return "" }
@@ -13,7 +13,7 @@ type DiskStats struct {
 	// Legacy support
 	Mountpoints []string
 
-	MountPoints []string
+	MountPoints []string `toml:"mount_points"`
 	IgnoreFS    []string `toml:"ignore_fs"`
 }
 
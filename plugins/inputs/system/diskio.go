@@ -2,7 +2,6 @@ package system
 
 import (
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 
@@ -19,9 +18,11 @@ type DiskIO struct {
 	ps PS
 
 	Devices          []string
-	DeviceTags       []string
-	NameTemplates    []string
-	SkipSerialNumber bool
+	DeviceTags       []string `toml:"device_tags"`
+	NameTemplates    []string `toml:"name_templates"`
+	SkipSerialNumber bool     `toml:"skip_serial_number"`
+
+	Log asgard.Logger `toml:"-"`
 
 	infoCache    map[string]diskInfoCache
 	deviceFilter filter.Filter
@@ -51,7 +52,8 @@ var diskIOsampleConfig = `
   ## name of the device via templates.
   ## The 'name_templates' parameter is a list of templates to try and apply to
   ## the device. The template may contain variables in the form of '$PROPERTY' or
-  ## '${PROPERTY}'. The first template which does not contain any variables not
+  ## '$${PROPERTY}', as ${PROPERTY} references an environment variable. The
+  ## first template which does not contain any variables not
   ## present for the device is used as the device name tag.
   ## The typical use case is for LVM volumes, to get the VG/LV name instead of
   ## the near-meaningless DM-0 name.
@@ -141,7 +143,7 @@ func (s *DiskIO) diskName(devName string) string {
 
 	di, err := s.diskInfo(devName)
 	if err != nil {
-		log.Printf("W! Error gathering disk info: %s", err)
+		s.Log.Warnf("Error gathering disk info: %s", err)
 		return devName
 	}
 
@@ -174,7 +176,7 @@ func (s *DiskIO) diskTags(devName string) map[string]string {
 
 	di, err := s.diskInfo(devName)
 	if err != nil {
-		log.Printf("W! Error gathering disk info: %s", err)
+		s.Log.Warnf("Error gathering disk info: %s", err)
 		return nil
 	}
 
@@ -1,19 +1,19 @@
 package influxdb
 
 import (
+	"crypto/tls"
 	"fmt"
-	"log"
 	"math/rand"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/anabiozz/asgard"
 	"github.com/anabiozz/asgard/internal"
+	"github.com/anabiozz/asgard/internal/secrets"
 	"github.com/anabiozz/asgard/metric"
 	"github.com/anabiozz/asgard/plugins/outputs"
 	"github.com/anabiozz/asgard/plugins/outputs/influxdb/client"
-
-	"github.com/BurntSushi/toml"
 )
 
 var (
@@ -26,12 +26,12 @@ type InfluxDB struct {
 	// URL is only for backwards compatibility
 	URL              string
 	URLs             []string `toml:"urls"`
-	Username         string
-	Password         string
+	Username         secrets.Secret
+	Password         secrets.Secret
 	Database         string
-	UserAgent        string
-	RetentionPolicy  string
-	WriteConsistency string
+	UserAgent        string `toml:"user_agent"`
+	RetentionPolicy  string `toml:"retention_policy"`
+	WriteConsistency string `toml:"write_consistency"`
 	Timeout          internal.Duration
 	UDPPayload       int               `toml:"udp_payload"`
 	HTTPProxy        string            `toml:"http_proxy"`
@@ -45,23 +45,24 @@ type InfluxDB struct {
 	// Path to cert key file
 	SSLKey string `toml:"ssl_key"`
 	// Use SSL but skip chain & host verification
-	InsecureSkipVerify bool
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
 
 	// Precision is only here for legacy support. It will be ignored.
 	Precision string
 
-	clients []client.Client
-}
+	Log asgard.Logger `toml:"-"`
 
-// Connect initiates the primary connection to the range of provided URLs
-func (i *InfluxDB) Connect() error {
-	var urls []string
+	clients   []client.Client
+	tlsConfig *tls.Config
+}
 
-	_, err := toml.Decode(sampleConfig, i)
-	if err != nil {
-		log.Fatalf("ERROR: %s", err)
-	}
+// defaultURL is written to when neither url nor urls is set
+const defaultURL = "http://influxdb:8086"
 
+// urls returns the configured URLs, or the default URL when none is
+// configured
+func (i *InfluxDB) urls() []string {
+	var urls []string
 	urls = append(urls, i.URLs...)
 
 	// Backward-compatibility with single Influx URL config files
@@ -69,13 +70,58 @@ func (i *InfluxDB) Connect() error {
 	if i.URL != "" {
 		urls = append(urls, i.URL)
 	}
+	if len(urls) == 0 {
+		urls = append(urls, defaultURL)
+	}
+	return urls
+}
+
+// Init checks the URLs, the TLS files and the enum settings
+func (i *InfluxDB) Init() error {
+	for _, u := range i.urls() {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("Error parsing url %q: %s", u, err)
+		}
+		switch parsed.Scheme {
+		case "http", "https", "udp", "udp4", "udp6":
+		default:
+			return fmt.Errorf("Unsupported scheme in url %q, expected http, https or udp", u)
+		}
+	}
+
+	switch i.ContentEncoding {
+	case "", "identity", "gzip":
+	default:
+		return fmt.Errorf("Invalid content_encoding %q, expected identity or gzip", i.ContentEncoding)
+	}
+
+	switch i.WriteConsistency {
+	case "", "any", "one", "quorum", "all":
+	default:
+		return fmt.Errorf("Invalid write_consistency %q, expected any, one, quorum or all", i.WriteConsistency)
+	}
 
 	tlsConfig, err := internal.GetTLSConfig(i.SSLCert, i.SSLKey, i.SSLCA, i.InsecureSkipVerify)
 	if err != nil {
-		log.Fatalf("ERROR: %s", err)
+		return err
+	}
+	i.tlsConfig = tlsConfig
+	return nil
+}
+
+// Connect initiates the primary connection to the range of provided URLs
+func (i *InfluxDB) Connect() error {
+	username, err := i.Username.Get()
+	if err != nil {
+		return fmt.Errorf("Error getting username: %s", err)
+	}
+	password, err := i.Password.Get()
+	if err != nil {
+		return fmt.Errorf("Error getting password: %s", err)
 	}
 
-	for _, u := range urls {
+	for _, u := range i.urls() {
 		switch {
 		case strings.HasPrefix(u, "udp"):
 			config := client.UDPConfig{
@@ -92,10 +138,10 @@ func (i *InfluxDB) Connect() error {
 			config := client.HTTPConfig{
 				URL:             u,
 				Timeout:         i.Timeout.Duration,
-				TLSConfig:       tlsConfig,
+				TLSConfig:       i.tlsConfig,
 				UserAgent:       i.UserAgent,
-				Username:        i.Username,
-				Password:        i.Password,
+				Username:        username,
+				Password:        password,
 				HTTPProxy:       i.HTTPProxy,
 				HTTPHeaders:     client.HTTPHeaders{},
 				ContentEncoding: i.ContentEncoding,
@@ -108,7 +154,7 @@ func (i *InfluxDB) Connect() error {
 				RetentionPolicy: i.RetentionPolicy,
 				Consistency:     i.WriteConsistency,
 			}
-			log.Printf("INFO: Connect to url: %s", u)
+			i.Log.Debugf("Connecting to %s", u)
 			c, err := client.NewHTTP(config, wp)
 			if err != nil {
 				return fmt.Errorf("Error creating HTTP Client [%s]: %s", u, err)
@@ -118,7 +164,7 @@ func (i *InfluxDB) Connect() error {
 			err = c.Query(fmt.Sprintf(`CREATE DATABASE "%s"`, qiReplacer.Replace(i.Database)))
 			if err != nil {
 				if !strings.Contains(err.Error(), "Status Code [403]") {
-					log.Fatalf("I! Database creation failed: %s", err.Error())
+					i.Log.Errorf("Database creation failed: %s", err)
 				}
 				continue
 			}
@@ -159,13 +205,12 @@ func (i *InfluxDB) Write(metrics []asgard.Metric) error {
 			if strings.Contains(e.Error(), "database not found") {
 				errc := i.clients[n].Query(fmt.Sprintf(`CREATE DATABASE "%s"`, qiReplacer.Replace(i.Database)))
 				if errc != nil {
-					log.Printf("E! Error: Database %s not found and failed to recreate\n",
-						i.Database)
+					i.Log.Errorf("Database %s not found and failed to recreate", i.Database)
 				}
 			}
 
 			if strings.Contains(e.Error(), "field type conflict") {
-				log.Printf("E! Field type conflict, dropping conflicted points: %s", e)
+				i.Log.Errorf("Field type conflict, dropping conflicted points: %s", e)
 				// setting err to nil, otherwise we will keep retrying and points
 				// w/ conflicting types will get stuck in the buffer forever.
 				err = nil
@@ -173,7 +218,7 @@ func (i *InfluxDB) Write(metrics []asgard.Metric) error {
 			}
 
 			if strings.Contains(e.Error(), "points beyond retention policy") {
-				log.Printf("W! Points beyond retention policy: %s", e)
+				i.Log.Warnf("Points beyond retention policy: %s", e)
 				// This error is indicates the point is older than the
 				// retention policy permits, and is probably not a cause for
 				// concern.  Retrying will not help unless the retention
@@ -183,7 +228,7 @@ func (i *InfluxDB) Write(metrics []asgard.Metric) error {
 			}
 
 			if strings.Contains(e.Error(), "unable to parse") {
-				log.Printf("E! Parse error; dropping points: %s", e)
+				i.Log.Errorf("Parse error; dropping points: %s", e)
 				// This error indicates a bug in Telegraf or InfluxDB parsing
 				// of line protocol.  Retries will not be successful.
 				err = nil
@@ -197,7 +242,7 @@ func (i *InfluxDB) Write(metrics []asgard.Metric) error {
 			}
 
 			// Log write failure
-			log.Printf("E! InfluxDB Output Error: %s", e)
+			i.Log.Errorf("Write failed: %s", e)
 		} else {
 			err = nil
 			break
@@ -209,9 +254,8 @@ func (i *InfluxDB) Write(metrics []asgard.Metric) error {
 
 func newInflux() *InfluxDB {
 	return &InfluxDB{
-		// Database: "telegraf",
-		// URL:      "http://127.0.0.1:8086",
-		Timeout: internal.Duration{Duration: time.Second * 5},
+		Database: "telegraf",
+		Timeout:  internal.Duration{Duration: time.Second * 5},
 	}
 }
 
@@ -241,6 +285,8 @@ var sampleConfig = `
   # timeout = "10s"
   # username = "telegraf"
   # password = "metricsmetricsmetricsmetrics"
+  ## Credentials may reference a configured secret store instead
+  # password = "@{local:influxdb_password}"
   ## Set the user agent for HTTP POSTs (can be useful for log differentiation)
   # user_agent = "telegraf"
   ## Set UDP payload size, defaults to InfluxDB UDP Client default (512 bytes)
@@ -0,0 +1,73 @@
+package influxdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		urls     []string
+		expected []string
+	}{
+		{
+			name:     "default",
+			expected: []string{defaultURL},
+		},
+		{
+			name:     "url only",
+			url:      "http://a:8086",
+			expected: []string{"http://a:8086"},
+		},
+		{
+			name:     "urls only",
+			urls:     []string{"http://a:8086", "udp://b:8089"},
+			expected: []string{"http://a:8086", "udp://b:8089"},
+		},
+		{
+			name:     "url and urls",
+			url:      "http://c:8086",
+			urls:     []string{"http://a:8086"},
+			expected: []string{"http://a:8086", "http://c:8086"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newInflux()
+			i.URL = tt.url
+			i.URLs = tt.urls
+			if urls := i.urls(); !reflect.DeepEqual(urls, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, urls)
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(i *InfluxDB)
+		invalid bool
+	}{
+		{name: "defaults", set: func(i *InfluxDB) {}},
+		{name: "udp url", set: func(i *InfluxDB) { i.URL = "udp://a:8089" }},
+		{name: "unknown scheme", set: func(i *InfluxDB) { i.URL = "tcp://a:8086" }, invalid: true},
+		{name: "gzip", set: func(i *InfluxDB) { i.ContentEncoding = "gzip" }},
+		{name: "unknown encoding", set: func(i *InfluxDB) { i.ContentEncoding = "br" }, invalid: true},
+		{name: "quorum", set: func(i *InfluxDB) { i.WriteConsistency = "quorum" }},
+		{name: "unknown consistency", set: func(i *InfluxDB) { i.WriteConsistency = "most" }, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newInflux()
+			tt.set(i)
+			if err := i.Init(); (err != nil) != tt.invalid {
+				t.Errorf("expected error %v, got %v", tt.invalid, err)
+			}
+		})
+	}
+}
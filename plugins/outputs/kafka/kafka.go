@@ -4,6 +4,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/internal"
+	"github.com/anabiozz/asgard/internal/secrets"
 	"github.com/anabiozz/asgard/plugins/outputs"
 	"github.com/anabiozz/asgard/plugins/serializers"
 	"strings"
@@ -28,11 +30,11 @@ type (
 		// Routing Key Tag
 		RoutingTag string `toml:"routing_tag"`
 		// Compression Codec Tag
-		CompressionCodec int
+		CompressionCodec int `toml:"compression_codec"`
 		// RequiredAcks Tag
-		RequiredAcks int
+		RequiredAcks int `toml:"required_acks"`
 		// MaxRetry Tag
-		MaxRetry int
+		MaxRetry int `toml:"max_retry"`
 
 		// Legacy SSL config options
 		// TLS client certificate
@@ -50,23 +52,28 @@ type (
 		SSLKey string `toml:"ssl_key"`
 
 		// Skip SSL verification
-		InsecureSkipVerify bool
+		InsecureSkipVerify bool `toml:"insecure_skip_verify"`
 
 		// SASL Username
-		SASLUsername string `toml:"sasl_username"`
+		SASLUsername secrets.Secret `toml:"sasl_username"`
 		// SASL Password
-		SASLPassword string `toml:"sasl_password"`
+		SASLPassword secrets.Secret `toml:"sasl_password"`
 
-		tlsConfig tls.Config
+		tlsConfig *tls.Config
 		producer  sarama.SyncProducer
 
 		serializer serializers.Serializer
+
+		Log asgard.Logger `toml:"-"`
 	}
 	TopicSuffix struct {
-		Method    string   `toml:"method"`
-		Keys      []string `toml:"keys"`
-		Separator string   `toml:"separator"`
+		Method    TopicSuffixMethod `toml:"method"`
+		Keys      []string          `toml:"keys"`
+		Separator string            `toml:"separator"`
 	}
+	// TopicSuffixMethod is one of ValidTopicSuffixMethods, it is validated
+	// when the config is decoded
+	TopicSuffixMethod string
 )
 
 var sampleConfig = `
@@ -142,6 +149,8 @@ var sampleConfig = `
   ## Optional SASL Config
   # sasl_username = "kafka"
   # sasl_password = "secret"
+  ## or, from a configured secret store
+  # sasl_password = "@{local:kafka_password}"
 
   ## Data format to output.
   ## Each data format has its own unique set of configuration options, read
@@ -157,7 +166,7 @@ func (k *Kafka) SampleConfig() string {
 
 // Description returns the human-readable function definition of the plugin
 func (k *Kafka) Description() string {
-	return "Configuration for influxdb server to send metrics to"
+	return "Configuration for the Kafka server to send metrics to"
 }
 
 func (k *Kafka) GetTopicName(metric asgard.Metric) string {
@@ -181,6 +190,16 @@ func (k *Kafka) GetTopicName(metric asgard.Metric) string {
 	return topicName
 }
 
+// UnmarshalText rejects unknown topic suffix methods while the config is
+// decoded
+func (m *TopicSuffixMethod) UnmarshalText(text []byte) error {
+	if err := ValidateTopicSuffixMethod(string(text)); err != nil {
+		return err
+	}
+	*m = TopicSuffixMethod(text)
+	return nil
+}
+
 func ValidateTopicSuffixMethod(method string) error {
 	for _, validMethod := range ValidTopicSuffixMethods {
 		if method == validMethod {
@@ -190,17 +209,20 @@ func ValidateTopicSuffixMethod(method string) error {
 	return fmt.Errorf("Unknown topic suffix method provided: %s", method)
 }
 
-func (k *Kafka) Connect() error {
-	err := ValidateTopicSuffixMethod(k.TopicSuffix.Method)
-	if err != nil {
+// Init checks the brokers, the enum settings and the TLS files
+func (k *Kafka) Init() error {
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("No brokers provided")
+	}
+	if err := ValidateTopicSuffixMethod(string(k.TopicSuffix.Method)); err != nil {
 		return err
 	}
-	config := sarama.NewConfig()
-
-	config.Producer.RequiredAcks = sarama.RequiredAcks(k.RequiredAcks)
-	config.Producer.Compression = sarama.CompressionCodec(k.CompressionCodec)
-	config.Producer.Retry.Max = k.MaxRetry
-	config.Producer.Return.Successes = true
+	if k.CompressionCodec < 0 || k.CompressionCodec > 2 {
+		return fmt.Errorf("Invalid compression_codec %d, expected 0, 1 or 2", k.CompressionCodec)
+	}
+	if k.RequiredAcks < -1 || k.RequiredAcks > 1 {
+		return fmt.Errorf("Invalid required_acks %d, expected -1, 0 or 1", k.RequiredAcks)
+	}
 
 	// Legacy support ssl config
 	if k.Certificate != "" {
@@ -209,13 +231,38 @@ func (k *Kafka) Connect() error {
 		k.SSLKey = k.Key
 	}
 
+	tlsConfig, err := internal.GetTLSConfig(k.SSLCert, k.SSLKey, k.SSLCA, k.InsecureSkipVerify)
 	if err != nil {
 		return err
 	}
+	k.tlsConfig = tlsConfig
+	return nil
+}
+
+func (k *Kafka) Connect() error {
+	config := sarama.NewConfig()
+
+	config.Producer.RequiredAcks = sarama.RequiredAcks(k.RequiredAcks)
+	config.Producer.Compression = sarama.CompressionCodec(k.CompressionCodec)
+	config.Producer.Retry.Max = k.MaxRetry
+	config.Producer.Return.Successes = true
+
+	if k.tlsConfig != nil {
+		config.Net.TLS.Config = k.tlsConfig
+		config.Net.TLS.Enable = true
+	}
 
-	if k.SASLUsername != "" && k.SASLPassword != "" {
-		config.Net.SASL.User = k.SASLUsername
-		config.Net.SASL.Password = k.SASLPassword
+	if !k.SASLUsername.Empty() && !k.SASLPassword.Empty() {
+		username, err := k.SASLUsername.Get()
+		if err != nil {
+			return fmt.Errorf("Error getting sasl_username: %s", err)
+		}
+		password, err := k.SASLPassword.Get()
+		if err != nil {
+			return fmt.Errorf("Error getting sasl_password: %s", err)
+		}
+		config.Net.SASL.User = username
+		config.Net.SASL.Password = password
 		config.Net.SASL.Enable = true
 	}
 
@@ -241,7 +288,7 @@ func (k *Kafka) Write(metrics []asgard.Metric) error {
 	}
 
 	for _, metric := range metrics {
-		fmt.Println(metric)
+		k.Log.Debugf("Sending %s", metric)
 		buf, err := k.serializer.Serialize(metric)
 		if err != nil {
 			return err
@@ -0,0 +1,15 @@
+package processors
+
+import "github.com/anabiozz/asgard"
+
+// Creator returns a new instance of a processor
+type Creator func() asgard.Processor
+
+// Processors are the registered processors by name
+var Processors = map[string]Creator{}
+
+// Add registers a processor, it is called from the init function of the
+// processor package
+func Add(name string, creator Creator) {
+	Processors[name] = creator
+}
@@ -0,0 +1,178 @@
+package rename
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/plugins/processors"
+)
+
+// Rename renames measurements, tags and fields and rewrites the values of
+// tags and string fields with regular expressions
+type Rename struct {
+	Replaces []Replace   `toml:"replace"`
+	Tags     []Transform `toml:"tags"`
+	Fields   []Transform `toml:"fields"`
+}
+
+// Replace renames a measurement, a tag key or a field key to Dest, exactly
+// one of Measurement, Tag and Field is set
+type Replace struct {
+	Measurement string `toml:"measurement"`
+	Tag         string `toml:"tag"`
+	Field       string `toml:"field"`
+	Dest        string `toml:"dest"`
+}
+
+// Transform rewrites the value of the Key tag or string field when it
+// matches Pattern. The result replaces the value, or is stored under
+// ResultKey when it is set. Replacement references the groups of Pattern
+// as ${1}, named groups must be written $${name} in the config file as
+// ${name} is read as an environment variable.
+type Transform struct {
+	Key         string `toml:"key"`
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+	ResultKey   string `toml:"result_key"`
+
+	re *regexp.Regexp
+}
+
+var sampleConfig = `
+  ## Renames are applied in order, before the values are rewritten.
+  ## Exactly one of measurement, tag and field is given.
+  [[processors.rename.replace]]
+    field = "usage_idle"
+    dest = "idle_pct"
+
+  # [[processors.rename.replace]]
+  #   measurement = "diskio"
+  #   dest = "disk_io"
+
+  # [[processors.rename.replace]]
+  #   tag = "name"
+  #   dest = "device"
+
+  ## Rewrites the value of a tag when it matches pattern, replacement may
+  ## reference the groups of pattern as ${1}, or $${name} for named groups as
+  ## ${name} references an environment variable. The result is stored in
+  ## result_key instead when one is given.
+  # [[processors.rename.tags]]
+  #   key = "host"
+  #   pattern = "^([^.]+)\\..*$"
+  #   replacement = "${1}"
+  #   # result_key = "short_host"
+
+  ## Same for the string fields
+  # [[processors.rename.fields]]
+  #   key = "state"
+  #   pattern = "(?i)^(up|running)$"
+  #   replacement = "ok"
+`
+
+func (*Rename) SampleConfig() string {
+	return sampleConfig
+}
+
+func (*Rename) Description() string {
+	return "Rename measurements, tags and fields and rewrite their values with regular expressions"
+}
+
+// Init checks the renames and compiles the patterns
+func (r *Rename) Init() error {
+	for _, rp := range r.Replaces {
+		var set int
+		var source string
+		for _, s := range []string{rp.Measurement, rp.Tag, rp.Field} {
+			if s != "" {
+				set++
+				source = s
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("Exactly one of measurement, tag and field must be given in replace")
+		}
+		if rp.Dest == "" {
+			return fmt.Errorf("No dest given to rename %q to", source)
+		}
+		if rp.Dest == source {
+			return fmt.Errorf("Can't rename %q to itself", source)
+		}
+	}
+
+	for _, transforms := range [][]Transform{r.Tags, r.Fields} {
+		for i := range transforms {
+			t := &transforms[i]
+			if t.Key == "" {
+				return fmt.Errorf("No key given for pattern %q", t.Pattern)
+			}
+			if t.Pattern == "" {
+				return fmt.Errorf("No pattern given for %q", t.Key)
+			}
+			re, err := regexp.Compile(t.Pattern)
+			if err != nil {
+				return fmt.Errorf("Error compiling pattern of %q: %s", t.Key, err)
+			}
+			t.re = re
+		}
+	}
+	return nil
+}
+
+// Apply renames and rewrites the metrics in place
+func (r *Rename) Apply(in ...asgard.Metric) []asgard.Metric {
+	for _, m := range in {
+		for _, rp := range r.Replaces {
+			switch {
+			case rp.Measurement != "":
+				if m.Name() == rp.Measurement {
+					m.SetName(rp.Dest)
+				}
+			case rp.Tag != "":
+				if value, ok := m.Tags()[rp.Tag]; ok {
+					m.RemoveTag(rp.Tag)
+					m.AddTag(rp.Dest, value)
+				}
+			case rp.Field != "":
+				if value, ok := m.Fields()[rp.Field]; ok {
+					// the field is added first, a metric can't lose its
+					// last field
+					m.AddField(rp.Dest, value)
+					m.RemoveField(rp.Field)
+				}
+			}
+		}
+
+		for _, t := range r.Tags {
+			value, ok := m.Tags()[t.Key]
+			if !ok || !t.re.MatchString(value) {
+				continue
+			}
+			m.AddTag(t.resultKey(), t.re.ReplaceAllString(value, t.Replacement))
+		}
+
+		for _, t := range r.Fields {
+			value, ok := m.Fields()[t.Key].(string)
+			if !ok || !t.re.MatchString(value) {
+				continue
+			}
+			m.AddField(t.resultKey(), t.re.ReplaceAllString(value, t.Replacement))
+		}
+	}
+	return in
+}
+
+// resultKey returns the key the rewritten value is stored under
+func (t *Transform) resultKey() string {
+	if t.ResultKey != "" {
+		return t.ResultKey
+	}
+	return t.Key
+}
+
+func init() {
+	processors.Add("rename", func() asgard.Processor {
+		return &Rename{}
+	})
+}
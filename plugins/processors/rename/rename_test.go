@@ -0,0 +1,169 @@
+package rename
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anabiozz/asgard/metric"
+)
+
+func TestApply(t *testing.T) {
+	tags := map[string]string{"host": "web1.example.com", "name": "sda"}
+	fields := map[string]interface{}{"usage_idle": 90.0, "state": "Running", "code": int64(1)}
+
+	tests := []struct {
+		name   string
+		rename Rename
+		// expected are the measurement, tags and fields of the renamed metric
+		measurement string
+		tags        map[string]string
+		fields      map[string]interface{}
+	}{
+		{
+			name:        "measurement",
+			rename:      Rename{Replaces: []Replace{{Measurement: "cpu", Dest: "processor"}}},
+			measurement: "processor",
+			tags:        tags,
+			fields:      fields,
+		},
+		{
+			name:        "tag",
+			rename:      Rename{Replaces: []Replace{{Tag: "name", Dest: "device"}}},
+			measurement: "cpu",
+			tags:        map[string]string{"host": "web1.example.com", "device": "sda"},
+			fields:      fields,
+		},
+		{
+			name:        "field",
+			rename:      Rename{Replaces: []Replace{{Field: "usage_idle", Dest: "idle_pct"}}},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      map[string]interface{}{"idle_pct": 90.0, "state": "Running", "code": int64(1)},
+		},
+		{
+			name: "missing keys",
+			rename: Rename{Replaces: []Replace{
+				{Measurement: "mem", Dest: "memory"},
+				{Tag: "usage_idle", Dest: "idle"},
+				{Field: "host", Dest: "server"},
+			}},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      fields,
+		},
+		{
+			name:        "tag transform",
+			rename:      Rename{Tags: []Transform{{Key: "host", Pattern: `^([^.]+)\..*$`, Replacement: "${1}"}}},
+			measurement: "cpu",
+			tags:        map[string]string{"host": "web1", "name": "sda"},
+			fields:      fields,
+		},
+		{
+			name:        "tag transform to result key",
+			rename:      Rename{Tags: []Transform{{Key: "host", Pattern: `^(?P<short>[^.]+)\..*$`, Replacement: "${short}", ResultKey: "short_host"}}},
+			measurement: "cpu",
+			tags:        map[string]string{"host": "web1.example.com", "name": "sda", "short_host": "web1"},
+			fields:      fields,
+		},
+		{
+			name:        "field transform",
+			rename:      Rename{Fields: []Transform{{Key: "state", Pattern: "(?i)^(up|running)$", Replacement: "ok"}}},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      map[string]interface{}{"usage_idle": 90.0, "state": "ok", "code": int64(1)},
+		},
+		{
+			name:        "field transform to result key",
+			rename:      Rename{Fields: []Transform{{Key: "state", Pattern: "^R", Replacement: "r", ResultKey: "state_lower"}}},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      map[string]interface{}{"usage_idle": 90.0, "state": "Running", "state_lower": "running", "code": int64(1)},
+		},
+		{
+			name: "no match",
+			rename: Rename{
+				Tags:   []Transform{{Key: "host", Pattern: `^db`, Replacement: "database", ResultKey: "role"}},
+				Fields: []Transform{{Key: "state", Pattern: "^stopped$", Replacement: "down"}},
+			},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      fields,
+		},
+		{
+			name:        "non string field",
+			rename:      Rename{Fields: []Transform{{Key: "code", Pattern: ".*", Replacement: "x"}}},
+			measurement: "cpu",
+			tags:        tags,
+			fields:      fields,
+		},
+		{
+			name: "renamed before the transforms",
+			rename: Rename{
+				Replaces: []Replace{{Tag: "host", Dest: "server"}},
+				Tags:     []Transform{{Key: "server", Pattern: `\.example\.com$`, Replacement: ""}},
+			},
+			measurement: "cpu",
+			tags:        map[string]string{"server": "web1", "name": "sda"},
+			fields:      fields,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rename.Init(); err != nil {
+				t.Fatal(err)
+			}
+			m, err := metric.New("cpu", tags, fields, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := tt.rename.Apply(m)
+			if len(out) != 1 {
+				t.Fatalf("expected 1 metric, got %d", len(out))
+			}
+			if name := out[0].Name(); name != tt.measurement {
+				t.Errorf("expected measurement %q, got %q", tt.measurement, name)
+			}
+			if !reflect.DeepEqual(out[0].Tags(), tt.tags) {
+				t.Errorf("expected tags %v, got %v", tt.tags, out[0].Tags())
+			}
+			if !reflect.DeepEqual(out[0].Fields(), tt.fields) {
+				t.Errorf("expected fields %v, got %v", tt.fields, out[0].Fields())
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name   string
+		rename Rename
+		err    string
+	}{
+		{name: "no source", rename: Rename{Replaces: []Replace{{Dest: "b"}}}, err: "Exactly one of"},
+		{name: "two sources", rename: Rename{Replaces: []Replace{{Tag: "a", Field: "a", Dest: "b"}}}, err: "Exactly one of"},
+		{name: "missing dest", rename: Rename{Replaces: []Replace{{Field: "a"}}}, err: "No dest given"},
+		{name: "same dest", rename: Rename{Replaces: []Replace{{Measurement: "a", Dest: "a"}}}, err: "to itself"},
+		{name: "missing key", rename: Rename{Tags: []Transform{{Pattern: "a"}}}, err: "No key given"},
+		{name: "missing pattern", rename: Rename{Fields: []Transform{{Key: "a", Replacement: "b"}}}, err: "No pattern given"},
+		{name: "bad pattern", rename: Rename{Tags: []Transform{{Key: "a", Pattern: "(a"}}}, err: "Error compiling pattern"},
+		{name: "valid", rename: Rename{Replaces: []Replace{{Tag: "a", Dest: "b"}}, Fields: []Transform{{Key: "a", Pattern: "a"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rename.Init()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package all
+
+import (
+	_ "github.com/anabiozz/asgard/plugins/secretstores/env"
+	_ "github.com/anabiozz/asgard/plugins/secretstores/file"
+)
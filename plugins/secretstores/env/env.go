@@ -0,0 +1,64 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/plugins/secretstores"
+)
+
+// Env reads secrets from environment variables and from the files of a
+// directory, such as the secrets mounted by docker or kubernetes.
+type Env struct {
+	Prefix    string `toml:"prefix"`
+	Directory string `toml:"directory"`
+}
+
+var sampleConfig = `
+  ## Secrets are looked up in the environment variable <prefix><key> first
+  # prefix = "ASGARD_"
+
+  ## then in the file <directory>/<key>, without its trailing newline
+  # directory = "/run/secrets"
+`
+
+func (*Env) Description() string {
+	return "Read secrets from environment variables and files"
+}
+
+func (*Env) SampleConfig() string { return sampleConfig }
+
+// Get returns the secret stored under key
+func (e *Env) Get(key string) ([]byte, error) {
+	if v, ok := os.LookupEnv(e.Prefix + key); ok {
+		return []byte(v), nil
+	}
+	if e.Directory == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", e.Prefix+key)
+	}
+
+	// keys name a file in the directory, never a path outside of it
+	if strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return nil, fmt.Errorf("invalid secret key %q", key)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(e.Directory, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("neither environment variable %s nor file %s exists",
+				e.Prefix+key, filepath.Join(e.Directory, key))
+		}
+		return nil, err
+	}
+	return bytes.TrimRight(contents, "\r\n"), nil
+}
+
+func init() {
+	secretstores.Add("env", func() asgard.SecretStore {
+		return &Env{}
+	})
+}
@@ -0,0 +1,178 @@
+package file
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anabiozz/asgard"
+	"github.com/anabiozz/asgard/plugins/secretstores"
+)
+
+// File keeps secrets in a JSON file, every secret encrypted with AES-256-GCM
+// under a key that is kept apart from the file.
+type File struct {
+	Path    string `toml:"path"`
+	KeyFile string `toml:"key_file"`
+	Key     string `toml:"key"`
+
+	mu sync.Mutex
+}
+
+var sampleConfig = `
+  ## File the encrypted secrets are kept in, secrets are added with
+  ##   asgard secrets set <id> <key> < value
+  path = "/etc/asgard/secrets.json"
+
+  ## File holding the 32 byte encryption key hex encoded, as created by
+  ##   openssl rand -hex 32
+  key_file = "/etc/asgard/secrets.key"
+
+  ## The hex encoded key may also be given directly, ie from the environment
+  # key = "${ASGARD_SECRETS_KEY}"
+`
+
+func (*File) Description() string {
+	return "Read secrets from an encrypted file"
+}
+
+func (*File) SampleConfig() string { return sampleConfig }
+
+// Get returns the secret stored under key
+func (f *File) Get(key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secrets, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	encoded, ok := secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("no secret %q in %s", key, f.Path)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("secret %q in %s is corrupt: %s", key, f.Path, err)
+	}
+
+	aead, err := f.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("secret %q in %s is corrupt", key, f.Path)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	// the key is authenticated too, so secrets can't be swapped in the file
+	value, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt secret %q in %s, wrong key?", key, f.Path)
+	}
+	return value, nil
+}
+
+// Set encrypts value and stores it under key
+func (f *File) Set(key string, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secrets, err := f.read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if secrets == nil {
+		secrets = make(map[string]string)
+	}
+
+	aead, err := f.cipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	secrets[key] = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, value, []byte(key)))
+
+	contents, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(f.Path, contents)
+}
+
+// read returns the encoded secrets of the file
+func (f *File) read() (map[string]string, error) {
+	if f.Path == "" {
+		return nil, fmt.Errorf("no path given")
+	}
+	contents, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(contents, &secrets); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", f.Path, err)
+	}
+	return secrets, nil
+}
+
+// cipher returns the AES-GCM cipher of the configured key
+func (f *File) cipher() (cipher.AEAD, error) {
+	encoded := f.Key
+	if f.KeyFile != "" {
+		contents, err := ioutil.ReadFile(f.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(contents)
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("no key_file or key given")
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("the key must be 32 bytes, hex encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFile replaces the secrets file in one step, readable by the owner only
+func writeFile(path string, contents []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func init() {
+	secretstores.Add("file", func() asgard.SecretStore {
+		return &File{}
+	})
+}
@@ -0,0 +1,174 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey  = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	otherKey = "ff0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "secrets.key")
+	if err := ioutil.WriteFile(keyFile, []byte(testKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// store is the store read from, the secrets are set with a
+		// store using testKey
+		store *File
+		// modify changes the encoded secrets of the file before reading
+		modify func(secrets map[string]string)
+		key    string
+		value  string
+		err    string
+	}{
+		{
+			name:  "key",
+			store: &File{Key: testKey},
+			key:   "password",
+			value: "s3cr3t",
+		},
+		{
+			name:  "key file",
+			store: &File{KeyFile: keyFile},
+			key:   "password",
+			value: "s3cr3t",
+		},
+		{
+			name:  "wrong key",
+			store: &File{Key: otherKey},
+			key:   "password",
+			err:   `could not decrypt secret "password"`,
+		},
+		{
+			name:  "unknown secret",
+			store: &File{Key: testKey},
+			key:   "missing",
+			err:   `no secret "missing"`,
+		},
+		{
+			name:  "swapped secrets",
+			store: &File{Key: testKey},
+			modify: func(secrets map[string]string) {
+				secrets["password"], secrets["username"] = secrets["username"], secrets["password"]
+			},
+			key: "password",
+			err: `could not decrypt secret "password"`,
+		},
+		{
+			name:  "truncated secret",
+			store: &File{Key: testKey},
+			modify: func(secrets map[string]string) {
+				secrets["password"] = "AAAA"
+			},
+			key: "password",
+			err: `secret "password" in`,
+		},
+		{
+			name:  "short key",
+			store: &File{Key: "0001"},
+			key:   "password",
+			err:   "the key must be 32 bytes",
+		},
+		{
+			name:  "no key",
+			store: &File{},
+			key:   "password",
+			err:   "no key_file or key given",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("secrets%d.json", i))
+			writer := &File{Path: path, Key: testKey}
+			if err := writer.Set("password", []byte("s3cr3t")); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Set("username", []byte("admin")); err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				modifyFile(t, path, tt.modify)
+			}
+
+			tt.store.Path = path
+			value, err := tt.store.Get(tt.key)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(value) != tt.value {
+				t.Errorf("expected %q, got %q", tt.value, value)
+			}
+		})
+	}
+}
+
+func TestFileNotPlaintext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asgard-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.json")
+
+	f := &File{Path: path, Key: testKey}
+	if err := f.Set("password", []byte("s3cr3t")); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(contents), "s3cr3t") {
+		t.Errorf("secret stored in plain text: %s", contents)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected mode 0600, got %o", perm)
+	}
+}
+
+// modifyFile rewrites the encoded secrets of the file at path
+func modifyFile(t *testing.T, path string, modify func(secrets map[string]string)) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(contents, &secrets); err != nil {
+		t.Fatal(err)
+	}
+	modify(secrets)
+	contents, err = json.Marshal(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,15 @@
+package secretstores
+
+import "github.com/anabiozz/asgard"
+
+// Creator ...
+type Creator func() asgard.SecretStore
+
+// SecretStores ...
+var SecretStores = map[string]Creator{}
+
+// Add registers a secret store under name, it is called by the store
+// packages in their init function.
+func Add(name string, creator Creator) {
+	SecretStores[name] = creator
+}
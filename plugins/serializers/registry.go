@@ -41,6 +41,9 @@ type Config struct {
 	TimestampUnits time.Duration
 }
 
+// DataFormats lists the data formats NewSerializer accepts
+var DataFormats = []string{"influx", "json"}
+
 // NewSerializer a Serializer interface based on the given config.
 func NewSerializer(config *Config) (Serializer, error) {
 	var err error
@@ -0,0 +1,15 @@
+package asgard
+
+// Processor transforms the metrics gathered by the inputs before they are
+// handed to the outputs, ie renames or drops them
+type Processor interface {
+	// SampleConfig returns the default configuration of the Processor
+	SampleConfig() string
+
+	// Description returns a one-sentence description on the Processor
+	Description() string
+
+	// Apply returns the metrics resulting from in. The metrics may be
+	// modified in place, dropped metrics are left out of the result.
+	Apply(in ...Metric) []Metric
+}
@@ -0,0 +1,20 @@
+package asgard
+
+// SecretStore holds secrets that plugins reference as @{<store id>:<key>}
+// instead of writing them into the config.
+type SecretStore interface {
+	// SampleConfig returns the default configuration of the SecretStore
+	SampleConfig() string
+
+	// Description returns a one-sentence description on the SecretStore
+	Description() string
+
+	// Get returns the secret stored under key
+	Get(key string) ([]byte, error)
+}
+
+// SecretSetter is implemented by secret stores that secrets can be written to
+type SecretSetter interface {
+	// Set stores value under key, replacing the secret stored before
+	Set(key string, value []byte) error
+}